@@ -1,10 +1,16 @@
 package configuration
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v8"
-	log "github.com/sirupsen/logrus"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 )
 
 // Config struct for configuration environmental variables
@@ -19,13 +25,128 @@ type Config struct {
 	ExcludeDomains       []string      `env:"EXCLUDE_DOMAIN_FILTER" envDefault:""`
 	RegexDomainFilter    string        `env:"REGEXP_DOMAIN_FILTER" envDefault:""`
 	RegexDomainExclusion string        `env:"REGEXP_DOMAIN_FILTER_EXCLUSION" envDefault:""`
+	LogLevel             string        `env:"LOG_LEVEL"`
+	LogFormat            string        `env:"LOG_FORMAT"`
+	// ReadinessAPICheckInterval is the minimum time between two API checks of the readiness, the result is cached in between.
+	ReadinessAPICheckInterval time.Duration `env:"READINESS_API_CHECK_INTERVAL" envDefault:"1m"`
+	// ReadinessCheckTimeout limits the duration of each check of the readiness.
+	ReadinessCheckTimeout time.Duration `env:"READINESS_CHECK_TIMEOUT" envDefault:"10s"`
+	// ReadinessMaxSyncFailures is the number of consecutive failed syncs, after which the webhook is not ready, 0 disables it.
+	ReadinessMaxSyncFailures int `env:"READINESS_MAX_SYNC_FAILURES" envDefault:"3"`
+	// ShutdownDrainTimeout is the time the running requests get to finish on shutdown, before they are cancelled.
+	ShutdownDrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT" envDefault:"30s"`
+	// ShutdownDelay is the time between failing the readiness check and closing the webhook server on shutdown, so that
+	// the webhook is removed from the endpoints of its service before it stops accepting requests.
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY" envDefault:"0s"`
+	// ServerTLSCertFile and ServerTLSKeyFile enable TLS for the webhook server, the files are reloaded when they change.
+	ServerTLSCertFile string `env:"SERVER_TLS_CERT_FILE"`
+	ServerTLSKeyFile  string `env:"SERVER_TLS_KEY_FILE"`
+	// ServerTLSClientCAFile enables the verification of the client certificates by the webhook server.
+	ServerTLSClientCAFile string `env:"SERVER_TLS_CLIENT_CA_FILE"`
+	// MetricsTLSCertFile and MetricsTLSKeyFile enable TLS for the exposed server, the files are reloaded when they change.
+	MetricsTLSCertFile string `env:"METRICS_TLS_CERT_FILE"`
+	MetricsTLSKeyFile  string `env:"METRICS_TLS_KEY_FILE"`
+	// MetricsTLSClientCAFile enables the verification of the client certificates by the exposed server.
+	MetricsTLSClientCAFile string `env:"METRICS_TLS_CLIENT_CA_FILE"`
+
+	// ConfigFile is the optional YAML config file set by the flag --config.
+	ConfigFile string
+	// PrintConfig is set by the flag --print-config.
+	PrintConfig bool
+	// environment holds the values of the config file overridden by the environment variables, nil means the
+	// environment variables only.
+	environment map[string]string
+}
+
+// ValidationError contains all errors found in the configuration.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Init sets up configuration from the command line flags, the optional config file and the environmental variables,
+// the environmental variables take precedence over the config file. All invalid settings are reported at once.
+func Init(args []string) (Config, error) {
+	flags := flag.NewFlagSet("external-dns-ionos-webhook", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML config file, whose keys are the names of the environment variables")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration with redacted secrets and exit")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg, err := Load(*configFile, os.Environ())
+	cfg.PrintConfig = *printConfig
+	return cfg, err
+}
+
+// Load reads the configuration from the config file, if it is set, and the environment, whose values take precedence.
+// It validates the configuration of the webhook and of the IONOS provider, the returned error is a ValidationError.
+func Load(configFile string, environ []string) (Config, error) {
+	var errs []error
+	environment := make(map[string]string, len(environ))
+	if configFile != "" {
+		fileValues, fileErrs := readConfigFile(configFile)
+		errs = append(errs, fileErrs...)
+		for key, value := range fileValues {
+			environment[key] = value
+		}
+	}
+	for key, value := range environMap(environ) {
+		environment[key] = value
+	}
+	cfg := Config{ConfigFile: configFile, environment: environment}
+	errs = append(errs, parseErrors(cfg.Parse(&cfg))...)
+	var ionosConfig ionos.Configuration
+	errs = append(errs, parseErrors(cfg.Parse(&ionosConfig))...)
+	if _, err := ionos.NewDomainFilter(cfg.DomainFilter, cfg.ExcludeDomains, cfg.RegexDomainFilter, cfg.RegexDomainExclusion); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ionosConfig.ValidateCredentials(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTLS("SERVER", cfg.ServerTLSCertFile, cfg.ServerTLSKeyFile, cfg.ServerTLSClientCAFile); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTLS("METRICS", cfg.MetricsTLSCertFile, cfg.MetricsTLSKeyFile, cfg.MetricsTLSClientCAFile); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return cfg, &ValidationError{Errors: errs}
+	}
+	return cfg, nil
 }
 
-// Init sets up configuration by reading set environmental variables
-func Init() Config {
-	cfg := Config{}
-	if err := env.Parse(&cfg); err != nil {
-		log.Fatalf("Error reading configuration from environment: %v", err)
+// validateTLS checks that the certificate and the key of a server are set together, and that client certificates are
+// only verified with TLS. The prefix is the one of the environment variables of the server.
+func validateTLS(prefix, certFile, keyFile, clientCAFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("%s_TLS_CERT_FILE and %s_TLS_KEY_FILE must be set together", prefix, prefix)
+	}
+	if clientCAFile != "" && certFile == "" {
+		return fmt.Errorf("%s_TLS_CLIENT_CA_FILE requires %s_TLS_CERT_FILE and %s_TLS_KEY_FILE", prefix, prefix, prefix)
+	}
+	return nil
+}
+
+// Parse parses the configuration of the config file and the environment into the struct with env tags.
+func (c Config) Parse(v any) error {
+	return env.ParseWithOptions(v, env.Options{Environment: c.environment})
+}
+
+// parseErrors splits the aggregated errors of env into single errors.
+func parseErrors(err error) []error {
+	var aggregateErr env.AggregateError
+	if errors.As(err, &aggregateErr) {
+		return aggregateErr.Errors
+	}
+	if err != nil {
+		return []error{err}
 	}
-	return cfg
+	return nil
 }
@@ -0,0 +1,153 @@
+package configuration
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v8"
+	"sigs.k8s.io/yaml"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+const redacted = "<redacted>"
+
+// secretKeys are redacted when the configuration is printed. The proxy URL may contain credentials and the auth header
+// may be a complete header value with credentials.
+var secretKeys = map[string]bool{
+	"IONOS_API_KEY":     true,
+	"IONOS_PASSWORD":    true,
+	"IONOS_PROXY_URL":   true,
+	"IONOS_AUTH_HEADER": true,
+}
+
+// readConfigFile returns the values of the config file by the keys of the environment variables. Lists are joined with
+// commas like in the environment variables. Keys are case-insensitive, unknown keys and nested values are errors.
+func readConfigFile(fileName string) (map[string]string, []error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read config file '%s': %w", fileName, err)}
+	}
+	var file map[string]any
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, []error{fmt.Errorf("failed to parse config file '%s': %w", fileName, err)}
+	}
+	known := effectiveValues(nil)
+	values := make(map[string]string, len(file))
+	var errs []error
+	for key, value := range file {
+		envKey := strings.ToUpper(key)
+		if _, ok := known[envKey]; !ok {
+			errs = append(errs, fmt.Errorf("unknown key '%s' in config file '%s'", key, fileName))
+			continue
+		}
+		formatted, err := formatValue(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value of '%s' in config file '%s': %w", key, fileName, err))
+			continue
+		}
+		values[envKey] = formatted
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return values, errs
+}
+
+// formatValue formats a value of the config file like an environment variable.
+func formatValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]any); ok {
+				return "", fmt.Errorf("lists must not be nested")
+			}
+			formatted, err := formatValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatted)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("must be a value or a list of values")
+	}
+}
+
+// effectiveValues returns the values of all keys of the webhook and the IONOS provider in the environment, including
+// the defaults. A nil environment returns the defaults, which is used to get all known keys.
+func effectiveValues(environment map[string]string) map[string]string {
+	if environment == nil {
+		environment = map[string]string{}
+	}
+	values := make(map[string]string)
+	options := env.Options{
+		Environment: environment,
+		OnSet: func(key string, value any, _ bool) {
+			if key != "" {
+				values[key] = fmt.Sprint(value)
+			}
+		},
+	}
+	// errors are reported by Load, the values are collected anyway
+	_ = env.ParseWithOptions(&Config{}, options)
+	_ = env.ParseWithOptions(&ionos.Configuration{}, options)
+	return values
+}
+
+// Print writes the effective configuration as YAML config file, the secrets are redacted.
+func (c Config) Print(w io.Writer) error {
+	environment := c.environment
+	if environment == nil {
+		environment = environMap(os.Environ())
+	}
+	values := effectiveValues(environment)
+	for key, value := range values {
+		values[key] = redactValue(key, value)
+	}
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// environMap converts the "key=value" pairs of os.Environ to a map.
+func environMap(environ []string) map[string]string {
+	environment := make(map[string]string, len(environ))
+	for _, keyValue := range environ {
+		if key, value, ok := strings.Cut(keyValue, "="); ok {
+			environment[key] = value
+		}
+	}
+	return environment
+}
+
+// redactValue returns the value to print, secrets are redacted and the user info of URLs is masked.
+func redactValue(key, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretKeys[key] {
+		return redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		// the username is masked as well, it may be a token
+		u.User = url.User("xxxxx")
+		return u.String()
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/multiaccount"
+)
+
+// initAccounts creates a provider per account of IONOS_ACCOUNTS_FILE and returns a provider combining them.
+// The credential variables have been validated to be unset.
+// The accounts share the configuration except for the credentials, the backend and the API URL.
+func initAccounts(domainFilter endpoint.DomainFilterInterface, ionosConfig ionos.Configuration) (provider.Provider, error) {
+	accounts, err := multiaccount.ReadAccountsFile(ionosConfig.AccountsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading ionos ionosConfig failed: %w", err)
+	}
+	accountsProvider, err := multiaccount.NewProvider(domainFilter, accounts, func(account multiaccount.Account, accountFilter endpoint.DomainFilterInterface) (provider.Provider, error) {
+		accountConfig := accountConfiguration(ionosConfig, account)
+		if err := resolveCredentials(&accountConfig); err != nil {
+			return nil, err
+		}
+		createProvider, backend, err := detectProvider(&accountConfig)
+		if err != nil {
+			return nil, err
+		}
+		return newProvider(createProvider, backend, accountFilter, &accountConfig)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accountsProvider, nil
+}
+
+// accountConfiguration returns a copy of the configuration with the name, credentials, backend and API URL of the
+// account. The name labels the metrics of the account. The state files get the account name as suffix, because the accounts must not share them.
+func accountConfiguration(ionosConfig ionos.Configuration, account multiaccount.Account) ionos.Configuration {
+	ionosConfig.AccountsFile = ""
+	ionosConfig.Account = account.Name
+	ionosConfig.APIKey = account.APIKey
+	ionosConfig.APIKeyFile = account.APIKeyFile
+	ionosConfig.Username = account.Username
+	ionosConfig.UsernameFile = account.UsernameFile
+	ionosConfig.Password = account.Password
+	ionosConfig.PasswordFile = account.PasswordFile
+	ionosConfig.Provider = account.Provider
+	ionosConfig.APIEndpointURL = account.APIURL
+	ionosConfig.AuthHeader = ""
+	ionosConfig.DeletionStateFile = accountFileName(ionosConfig.DeletionStateFile, account.Name)
+	if ionosConfig.AuditLog != ionos.AuditStdout {
+		ionosConfig.AuditLog = accountFileName(ionosConfig.AuditLog, account.Name)
+	}
+	return ionosConfig
+}
+
+// accountFileName inserts the account name before the extension of the file name, e.g. 'state-contract-a.json'.
+func accountFileName(fileName, accountName string) string {
+	if fileName == "" {
+		return ""
+	}
+	extension := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, extension) + "-" + accountName + extension
+}
@@ -1,16 +1,10 @@
 package dnsprovider
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"regexp"
-	"strings"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionoscloud"
 
-	"github.com/caarlos0/env/v8"
-
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionoscore"
@@ -19,7 +13,7 @@ import (
 	"sigs.k8s.io/external-dns/provider"
 )
 
-type IONOSProviderFactory func(domainFilter *endpoint.DomainFilter, ionosConfig *ionos.Configuration) provider.Provider
+type IONOSProviderFactory func(domainFilter endpoint.DomainFilterInterface, ionosConfig *ionos.Configuration) (provider.Provider, error)
 
 func setDefaults(apiEndpointURL, authHeader string, ionosConfig *ionos.Configuration) {
 	if ionosConfig.APIEndpointURL == "" {
@@ -30,66 +24,139 @@ func setDefaults(apiEndpointURL, authHeader string, ionosConfig *ionos.Configura
 	}
 }
 
-var IonosCoreProviderFactory = func(domainFilter *endpoint.DomainFilter, ionosConfig *ionos.Configuration) provider.Provider {
+var IonosCoreProviderFactory = func(domainFilter endpoint.DomainFilterInterface, ionosConfig *ionos.Configuration) (provider.Provider, error) {
 	setDefaults("https://api.hosting.ionos.com/dns", "X-API-Key", ionosConfig)
 	return ionoscore.NewProvider(domainFilter, ionosConfig)
 }
 
-var IonosCloudProviderFactory = func(domainFilter *endpoint.DomainFilter, ionosConfig *ionos.Configuration) provider.Provider {
+var IonosCloudProviderFactory = func(domainFilter endpoint.DomainFilterInterface, ionosConfig *ionos.Configuration) (provider.Provider, error) {
 	setDefaults("https://dns.de-fra.ionos.com", "Bearer", ionosConfig)
 	return ionoscloud.NewProvider(domainFilter, ionosConfig)
 }
 
-func Init(config configuration.Config) (provider.Provider, error) {
-	var domainFilter *endpoint.DomainFilter
-	createMsg := "Creating IONOS provider with "
-
-	if config.RegexDomainFilter != "" {
-		createMsg += fmt.Sprintf("Regexp domain filter: '%s', ", config.RegexDomainFilter)
-		if config.RegexDomainExclusion != "" {
-			createMsg += fmt.Sprintf("with exclusion: '%s', ", config.RegexDomainExclusion)
-		}
-		domainFilter = endpoint.NewRegexDomainFilter(
-			regexp.MustCompile(config.RegexDomainFilter),
-			regexp.MustCompile(config.RegexDomainExclusion),
-		)
-	} else {
-		if len(config.DomainFilter) > 0 {
-			createMsg += fmt.Sprintf("zoneNode filter: '%s', ", strings.Join(config.DomainFilter, ","))
-		}
-		if len(config.ExcludeDomains) > 0 {
-			createMsg += fmt.Sprintf("Exclude domain filter: '%s', ", strings.Join(config.ExcludeDomains, ","))
-		}
-		domainFilter = endpoint.NewDomainFilterWithExclusions(config.DomainFilter, config.ExcludeDomains)
+// Close stops the background work of the provider, e.g. after it has been replaced by a reload.
+func Close(ionosProvider provider.Provider) {
+	if closer, ok := ionosProvider.(interface{ Close() }); ok {
+		closer.Close()
 	}
+}
 
-	createMsg = strings.TrimSuffix(createMsg, ", ")
-	if strings.HasSuffix(createMsg, "with ") {
-		createMsg += "no kind of domain filters"
+func Init(config configuration.Config) (provider.Provider, error) {
+	domainFilter, err := ionos.NewDomainFilter(config.DomainFilter, config.ExcludeDomains, config.RegexDomainFilter, config.RegexDomainExclusion)
+	if err != nil {
+		return nil, fmt.Errorf("reading domain filter configuration failed: %w", err)
 	}
-	log.Info(createMsg)
+	log.Infof("Creating IONOS provider with %s", domainFilter)
 	ionosConfig := ionos.Configuration{}
-	if err := env.Parse(&ionosConfig); err != nil {
+	if err := config.Parse(&ionosConfig); err != nil {
 		return nil, fmt.Errorf("reading ionos ionosConfig failed: %v", err)
 	}
-	createProvider := detectProvider(&ionosConfig)
-	ionosProvider := createProvider(domainFilter, &ionosConfig)
+	if zoneFilter := ionos.NewZoneFilter(ionosConfig.ZoneIDFilter, ionosConfig.ZoneNameFilter, ionosConfig.ExcludeZoneNameFilter); zoneFilter.IsConfigured() {
+		log.Infof("Using zone filter with %s", zoneFilter)
+	}
+	if len(ionosConfig.ProtectedRecords) > 0 {
+		log.Infof("Protecting records: %v, apex NS records: %v", ionosConfig.ProtectedRecords, ionosConfig.ProtectApexNS)
+	}
+	if err := resolveCredentials(&ionosConfig); err != nil {
+		return nil, fmt.Errorf("reading ionos ionosConfig failed: %w", err)
+	}
+	if ionosConfig.AccountsFile != "" {
+		return initAccounts(domainFilter, ionosConfig)
+	}
+	createProvider, backend, err := detectProvider(&ionosConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newProvider(createProvider, backend, domainFilter, &ionosConfig)
+}
+
+// newProvider creates the provider and checks its API, if the startup check is enabled.
+func newProvider(createProvider IONOSProviderFactory, backend string, domainFilter endpoint.DomainFilterInterface, ionosConfig *ionos.Configuration) (provider.Provider, error) {
+	ionosProvider, err := createProvider(domainFilter, ionosConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := startupCheck(ionosProvider, backend, ionosConfig); err != nil {
+		Close(ionosProvider)
+		return nil, err
+	}
 	return ionosProvider, nil
 }
 
-func detectProvider(ionosConfig *ionos.Configuration) IONOSProviderFactory {
-	split := strings.Split(ionosConfig.APIKey, ".")
-	if len(split) == 3 {
-		tokenBytes, err := base64.RawStdEncoding.DecodeString(split[1])
+// startupCheck checks the API of the provider, if the startup check is enabled.
+func startupCheck(ionosProvider provider.Provider, backend string, ionosConfig *ionos.Configuration) error {
+	if !ionosConfig.StartupCheck {
+		return nil
+	}
+	checker, ok := ionosProvider.(ionos.APIChecker)
+	if !ok {
+		return nil
+	}
+	apiKey := ionosConfig.APIKey
+	if keyProvider, ok := ionosProvider.(ionos.APIKeyProvider); ok {
+		// the token obtained with username and password
+		apiKey = keyProvider.APIKey()
+	}
+	return checkAPI(checker, backend, apiKey, ionosConfig.StartupCheckTimeout)
+}
+
+// resolveCredentials validates the credentials and reads the API key from IONOS_API_KEY_FILE, if it is set.
+func resolveCredentials(ionosConfig *ionos.Configuration) error {
+	if err := ionosConfig.ValidateCredentials(); err != nil {
+		return err
+	}
+	if ionosConfig.APIKeyFile != "" {
+		apiKey, err := ionos.ReadSecretFile(ionosConfig.APIKeyFile)
 		if err != nil {
-			return IonosCoreProviderFactory
+			return err
 		}
-		var tokenMap map[string]interface{}
-		err = json.Unmarshal(tokenBytes, &tokenMap)
-		if err != nil {
-			return IonosCoreProviderFactory
+		ionosConfig.APIKey = apiKey
+	}
+	return nil
+}
+
+// detectProvider returns the factory and the name of the backend selected by IONOS_PROVIDER, in auto mode by the format
+// of the API key. An explicit selection contradicting the format of the API key is an error. Username and password
+// are only supported by the IONOS Cloud API.
+func detectProvider(ionosConfig *ionos.Configuration) (IONOSProviderFactory, string, error) {
+	if ionosConfig.Username != "" || ionosConfig.UsernameFile != "" {
+		if ionosConfig.Provider == ionos.ProviderCore {
+			return nil, "", fmt.Errorf("IONOS_PROVIDER is '%s', but IONOS_USERNAME is only supported by the IONOS Cloud API", ionosConfig.Provider)
+		}
+		log.Infof("Using IONOS %s backend: IONOS_USERNAME is set", ionos.BackendCloud)
+		return IonosCloudProviderFactory, ionos.BackendCloud, nil
+	}
+	_, jwtErr := ionos.ParseJWTClaims(ionosConfig.APIKey)
+	isJWT := jwtErr == nil
+	var reason string
+	switch ionosConfig.Provider {
+	case ionos.ProviderCore:
+		if isJWT {
+			return nil, "", fmt.Errorf("IONOS_PROVIDER is '%s', but IONOS_API_KEY is a JWT of the IONOS Cloud API", ionosConfig.Provider)
+		}
+		reason = "selected by IONOS_PROVIDER"
+	case ionos.ProviderCloud:
+		if !isJWT {
+			return nil, "", fmt.Errorf("IONOS_PROVIDER is '%s', but IONOS_API_KEY is no JWT, because %v", ionosConfig.Provider, jwtErr)
 		}
-		return IonosCloudProviderFactory
+		reason = "selected by IONOS_PROVIDER"
+	default:
+		if isJWT {
+			reason = "IONOS_API_KEY is a JWT"
+		} else {
+			reason = fmt.Sprintf("IONOS_API_KEY is no JWT, because %v", jwtErr)
+		}
+	}
+	if isJWT {
+		log.Infof("Using IONOS %s backend: %s", ionos.BackendCloud, reason)
+		return IonosCloudProviderFactory, ionos.BackendCloud, nil
 	}
-	return IonosCoreProviderFactory
+	log.Infof("Using IONOS %s backend: %s", ionos.BackendCore, reason)
+	return IonosCoreProviderFactory, ionos.BackendCore, nil
+}
+
+// isJWT returns if the api key is a JWT, which is used by the IONOS Cloud API.
+func isJWT(apiKey string) bool {
+	_, err := ionos.ParseJWTClaims(apiKey)
+	return err == nil
 }
@@ -2,14 +2,21 @@ package dnsprovider
 
 import (
 	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionoscloud"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionoscore"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/multiaccount"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInit(t *testing.T) {
@@ -49,15 +56,108 @@ func TestInit(t *testing.T) {
 			},
 			providerType: "cloud",
 		},
+		{
+			name:   "ionos cloud provider, token payload with url safe characters",
+			config: configuration.Config{},
+			env: map[string]string{
+				"IONOS_API_KEY": "algorithm." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"~~~~"}`)) + ".signature",
+			},
+			providerType: "cloud",
+		},
+		{
+			name:         "ionos core provider selected explicitly",
+			config:       configuration.Config{},
+			env:          map[string]string{"IONOS_API_KEY": "prefix.secret", "IONOS_PROVIDER": "core"},
+			providerType: "core",
+		},
+		{
+			name:   "ionos cloud provider selected explicitly",
+			config: configuration.Config{},
+			env: map[string]string{
+				"IONOS_API_KEY":  "algorithm." + jwtPayloadEncoded + ".signature",
+				"IONOS_PROVIDER": "Cloud",
+			},
+			providerType: "cloud",
+		},
+		{
+			name:   "ionos core provider selected explicitly with a jwt",
+			config: configuration.Config{},
+			env: map[string]string{
+				"IONOS_API_KEY":  "algorithm." + jwtPayloadEncoded + ".signature",
+				"IONOS_PROVIDER": "core",
+			},
+			expectedError: "IONOS_PROVIDER is 'core', but IONOS_API_KEY is a JWT of the IONOS Cloud API",
+		},
+		{
+			name:          "ionos cloud provider selected explicitly without a jwt",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY": "prefix.secret", "IONOS_PROVIDER": "cloud"},
+			expectedError: "IONOS_PROVIDER is 'cloud', but IONOS_API_KEY is no JWT, because it has 2 instead of 3 dot separated segments",
+		},
+		{
+			name:          "invalid provider",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY": "prefix.secret", "IONOS_PROVIDER": "hosting"},
+			expectedError: "reading ionos ionosConfig failed: env: parse error on field \"Provider\" of type \"ionos.ProviderSelection\": invalid provider 'hosting', must be 'core', 'cloud' or 'auto'",
+		},
+		{
+			name:         "config with list and regex domain filters",
+			config:       configuration.Config{DomainFilter: []string{"a.de"}, ExcludeDomains: []string{"b.a.de"}, RegexDomainFilter: "^www\\."},
+			env:          map[string]string{"IONOS_API_KEY": "apikey must be there"},
+			providerType: "core",
+		},
+		{
+			name:          "invalid regex domain filter",
+			config:        configuration.Config{RegexDomainFilter: "a("},
+			env:           map[string]string{"IONOS_API_KEY": "apikey must be there"},
+			expectedError: "reading domain filter configuration failed: invalid regular expression for domain filter 'a(': error parsing regexp: missing closing ): `a(`",
+		},
+		{
+			name:          "invalid protection rule",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY": "apikey must be there", "PROTECTED_RECORDS": "a.de:MX,[a:TXT"},
+			expectedError: "reading ionos ionosConfig failed: env: parse error on field \"ProtectedRecords\" of type \"[]ionos.ProtectionRule\": protection rule '[a:TXT' has an invalid name pattern: syntax error in pattern",
+		},
 		{
 			name:          "without api key you are not able to create provider",
 			config:        configuration.Config{},
-			expectedError: "reading ionos ionosConfig failed: env: environment variable \"IONOS_API_KEY\" should not be empty",
+			expectedError: "reading ionos ionosConfig failed: IONOS_API_KEY, IONOS_API_KEY_FILE or IONOS_USERNAME and IONOS_PASSWORD must be set",
+		},
+		{
+			name:          "username without password",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_USERNAME": "user"},
+			expectedError: "reading ionos ionosConfig failed: IONOS_USERNAME and IONOS_PASSWORD must be set together",
+		},
+		{
+			name:          "api key and username",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY": "prefix.secret", "IONOS_USERNAME": "user", "IONOS_PASSWORD_FILE": "/password"},
+			expectedError: "reading ionos ionosConfig failed: only one of IONOS_API_KEY and IONOS_USERNAME must be set",
+		},
+		{
+			name:          "username for the ionos core provider",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_USERNAME": "user", "IONOS_PASSWORD": "secret", "IONOS_PROVIDER": "core"},
+			expectedError: "IONOS_PROVIDER is 'core', but IONOS_USERNAME is only supported by the IONOS Cloud API",
+		},
+		{
+			name:          "api key and api key file",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY": "prefix.secret", "IONOS_API_KEY_FILE": "/api-key"},
+			expectedError: "reading ionos ionosConfig failed: only one of IONOS_API_KEY and IONOS_API_KEY_FILE must be set",
+		},
+		{
+			name:          "missing api key file",
+			config:        configuration.Config{},
+			env:           map[string]string{"IONOS_API_KEY_FILE": "/does/not/exist"},
+			expectedError: "reading ionos ionosConfig failed: failed to read secret file '/does/not/exist': open /does/not/exist: no such file or directory",
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
 			for k, v := range tc.env {
 				t.Setenv(k, v)
 			}
@@ -68,6 +168,7 @@ func TestInit(t *testing.T) {
 			}
 			assert.NoErrorf(t, err, "error creating provider")
 			assert.NotNil(t, dnsProvider)
+			defer Close(dnsProvider)
 			if tc.providerType == "core" {
 				_, ok := dnsProvider.(*ionoscore.Provider)
 				assert.True(t, ok, "provider is not of type ionoscore.Provider")
@@ -78,3 +179,102 @@ func TestInit(t *testing.T) {
 		})
 	}
 }
+
+func TestInitWithAPIKeyFile(t *testing.T) {
+	apiKeyFile := filepath.Join(t.TempDir(), "api-key")
+	jwt := "algorithm." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":4102444800}`)) + ".signature"
+	assert.NoError(t, os.WriteFile(apiKeyFile, []byte(jwt+"\n"), 0o600))
+	t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
+	t.Setenv("IONOS_API_KEY_FILE", apiKeyFile)
+
+	dnsProvider, err := Init(configuration.Config{})
+	assert.NoError(t, err)
+	_, ok := dnsProvider.(*ionoscloud.Provider)
+	assert.True(t, ok, "provider is not of type ionoscloud.Provider")
+}
+
+func TestInitWithAccountsFile(t *testing.T) {
+	accountsFile := filepath.Join(t.TempDir(), "accounts.yaml")
+	jwt := "algorithm." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":4102444800}`)) + ".signature"
+	assert.NoError(t, os.WriteFile(accountsFile, []byte(`
+accounts:
+  - name: contract-a
+    zones: [example.com]
+    apiKey: `+jwt+`
+  - name: hosting
+    provider: core
+    zones: [example.org]
+    apiKey: prefix.secret
+`), 0o600))
+	t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
+	t.Setenv("IONOS_ACCOUNTS_FILE", accountsFile)
+
+	dnsProvider, err := Init(configuration.Config{DomainFilter: []string{"example.com", "example.net"}})
+	assert.NoError(t, err)
+	_, ok := dnsProvider.(*multiaccount.Provider)
+	assert.True(t, ok, "provider is not of type multiaccount.Provider")
+	assert.True(t, dnsProvider.GetDomainFilter().Match("www.example.com"))
+	assert.False(t, dnsProvider.GetDomainFilter().Match("www.example.org"), "excluded by the domain filter")
+	assert.False(t, dnsProvider.GetDomainFilter().Match("www.example.net"), "no account owns the zone")
+
+	t.Setenv("IONOS_API_KEY", "prefix.secret")
+	_, err = Init(configuration.Config{})
+	assert.EqualError(t, err, "reading ionos ionosConfig failed: IONOS_ACCOUNTS_FILE must not be combined with IONOS_API_KEY, the credentials are set per account")
+}
+
+func TestInitWithAccountsOfTheSameBackend(t *testing.T) {
+	accountsFile := filepath.Join(t.TempDir(), "accounts.yaml")
+	jwt := func(exp int64) string {
+		return "algorithm." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp))) + ".signature"
+	}
+	assert.NoError(t, os.WriteFile(accountsFile, []byte(`
+accounts:
+  - name: contract-a
+    zones: [example.com]
+    apiKey: `+jwt(4102444800)+`
+  - name: contract-b
+    zones: [example.org]
+    apiKey: `+jwt(4102444900)+`
+`), 0o600))
+	t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
+	t.Setenv("IONOS_ACCOUNTS_FILE", accountsFile)
+
+	dnsProvider, err := Init(configuration.Config{})
+	require.NoError(t, err)
+	defer Close(dnsProvider)
+
+	// each account exports the expiry of its own token
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	expiries := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "ionos_webhook_credential_expiry_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "account" {
+					expiries[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	require.Contains(t, expiries, "contract-a")
+	require.Contains(t, expiries, "contract-b")
+	assert.InDelta(t, 100, expiries["contract-b"]-expiries["contract-a"], 1)
+}
+
+func TestAccountConfiguration(t *testing.T) {
+	accountConfig := accountConfiguration(ionos.Configuration{AccountsFile: "accounts.yaml", DeletionStateFile: "/state/deletions.json"},
+		multiaccount.Account{Name: "contract-a", APIKey: "prefix.secret"})
+	assert.Equal(t, "contract-a", accountConfig.Account)
+	assert.Equal(t, "prefix.secret", accountConfig.APIKey)
+	assert.Empty(t, accountConfig.AccountsFile)
+	assert.Equal(t, "/state/deletions-contract-a.json", accountConfig.DeletionStateFile)
+}
+
+func TestAccountFileName(t *testing.T) {
+	assert.Equal(t, "/state/deletions-contract-a.json", accountFileName("/state/deletions.json", "contract-a"))
+	assert.Equal(t, "/var/log/audit-contract-a", accountFileName("/var/log/audit", "contract-a"))
+	assert.Equal(t, "", accountFileName("", "contract-a"))
+}
@@ -0,0 +1,95 @@
+package dnsprovider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+// StartupCheckError is returned by Init, if the API check at startup failed. Reason describes the likely cause.
+type StartupCheckError struct {
+	Backend string
+	Reason  string
+	Err     error
+}
+
+func (e *StartupCheckError) Error() string {
+	return fmt.Sprintf("startup check of the IONOS %s API failed: %s: %v", e.Backend, e.Reason, e.Err)
+}
+
+func (e *StartupCheckError) Unwrap() error {
+	return e.Err
+}
+
+// checkAPI makes one authenticated read against the API of the backend and explains a failure.
+func checkAPI(checker ionos.APIChecker, backend string, apiKey string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.Infof("checking the IONOS %s API ...", backend)
+	if err := checker.CheckAPI(ctx); err != nil {
+		return &StartupCheckError{Backend: backend, Reason: diagnose(err, backend, apiKey), Err: err}
+	}
+	log.Infof("IONOS %s API check succeeded", backend)
+	return nil
+}
+
+// diagnose returns the likely cause of the failed API check.
+func diagnose(err error, backend string, apiKey string) string {
+	var apiErr *ionos.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			if isJWT(apiKey) != (backend == ionos.BackendCloud) {
+				return fmt.Sprintf("wrong backend for this key type, the key is %s, but the %s API is used", keyType(apiKey), backend)
+			}
+			return fmt.Sprintf("invalid API key, the API responded with status %d", apiErr.StatusCode)
+		case http.StatusNotFound:
+			return "the API endpoint was not found, check IONOS_API_URL"
+		default:
+			return fmt.Sprintf("unexpected response status %d", apiErr.StatusCode)
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Sprintf("DNS lookup of '%s' failed", dnsErr.Name)
+	}
+	if isTLSError(err) {
+		return "TLS handshake with the API failed"
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "the API did not respond in time"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return "connection to the API failed"
+	}
+	return "the API request failed"
+}
+
+func isTLSError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verificationErr) || errors.As(err, &recordHeaderErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+func keyType(apiKey string) string {
+	if isJWT(apiKey) {
+		return "an IONOS Cloud token"
+	}
+	return "an IONOS API key"
+}
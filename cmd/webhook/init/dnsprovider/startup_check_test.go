@@ -0,0 +1,153 @@
+package dnsprovider
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+func TestInitWithStartupCheck(t *testing.T) {
+	cases := []struct {
+		name           string
+		status         int
+		body           string
+		expectedReason string
+	}{
+		{name: "api key accepted", status: http.StatusOK, body: "[]"},
+		{name: "api key rejected", status: http.StatusUnauthorized, expectedReason: "invalid API key, the API responded with status 401"},
+		{name: "wrong api url", status: http.StatusNotFound, expectedReason: "the API endpoint was not found, check IONOS_API_URL"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer api.Close()
+			t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
+			t.Setenv("IONOS_API_KEY", "prefix.secret")
+			t.Setenv("IONOS_API_URL", api.URL)
+			t.Setenv("IONOS_STARTUP_CHECK", "true")
+
+			dnsProvider, err := Init(configuration.Config{})
+			if tc.expectedReason == "" {
+				require.NoError(t, err)
+				assert.NotNil(t, dnsProvider)
+				return
+			}
+			var startupCheckErr *StartupCheckError
+			require.ErrorAs(t, err, &startupCheckErr)
+			assert.Equal(t, ionos.BackendCore, startupCheckErr.Backend)
+			assert.Equal(t, tc.expectedReason, startupCheckErr.Reason)
+		})
+	}
+}
+
+func TestStartupCheckUsesTheObtainedToken(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/tokens/generate" {
+			// a token, which is no JWT, is diagnosed as the key of the wrong backend
+			_, _ = w.Write([]byte(`{"token":"prefix.secret"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer api.Close()
+	t.Setenv("IONOS_ZONE_DISCOVERY_INTERVAL", "0")
+	t.Setenv("IONOS_USERNAME", "user")
+	t.Setenv("IONOS_PASSWORD", "secret")
+	t.Setenv("IONOS_AUTH_API_URL", api.URL+"/auth")
+	t.Setenv("IONOS_API_URL", api.URL)
+	t.Setenv("IONOS_STARTUP_CHECK", "true")
+
+	_, err := Init(configuration.Config{})
+	var startupCheckErr *StartupCheckError
+	require.ErrorAs(t, err, &startupCheckErr)
+	assert.Equal(t, ionos.BackendCloud, startupCheckErr.Backend)
+	assert.Equal(t, "wrong backend for this key type, the key is an IONOS API key, but the cloud API is used", startupCheckErr.Reason)
+}
+
+func TestDiagnose(t *testing.T) {
+	jwt := "algorithm." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1}`)) + ".signature"
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tlsServer.Close()
+	_, tlsErr := http.Get(tlsServer.URL)
+	require.Error(t, tlsErr)
+
+	cases := []struct {
+		name     string
+		err      error
+		backend  string
+		apiKey   string
+		expected string
+	}{
+		{
+			name:     "unauthorized",
+			err:      ionos.NewAPIError(http.StatusUnauthorized, errors.New("401 Unauthorized")),
+			backend:  ionos.BackendCloud,
+			apiKey:   jwt,
+			expected: "invalid API key, the API responded with status 401",
+		},
+		{
+			name:     "token for the hosting api",
+			err:      ionos.NewAPIError(http.StatusUnauthorized, errors.New("401 Unauthorized")),
+			backend:  ionos.BackendCore,
+			apiKey:   jwt,
+			expected: "wrong backend for this key type, the key is an IONOS Cloud token, but the core API is used",
+		},
+		{
+			name:     "api key for the cloud api",
+			err:      ionos.NewAPIError(http.StatusForbidden, errors.New("403 Forbidden")),
+			backend:  ionos.BackendCloud,
+			apiKey:   "prefix.secret",
+			expected: "wrong backend for this key type, the key is an IONOS API key, but the cloud API is used",
+		},
+		{
+			name:     "server error",
+			err:      ionos.NewAPIError(http.StatusBadGateway, errors.New("502 Bad Gateway")),
+			expected: "unexpected response status 502",
+		},
+		{
+			name:     "dns failure",
+			err:      fmt.Errorf("get zones: %w", &net.OpError{Op: "dial", Err: &net.DNSError{Name: "dns.example.com", Err: "no such host"}}),
+			expected: "DNS lookup of 'dns.example.com' failed",
+		},
+		{
+			name:     "tls error",
+			err:      tlsErr,
+			expected: "TLS handshake with the API failed",
+		},
+		{
+			name:     "timeout",
+			err:      fmt.Errorf("get zones: %w", context.DeadlineExceeded),
+			expected: "the API did not respond in time",
+		},
+		{
+			name:     "connection refused",
+			err:      &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			expected: "connection to the API failed",
+		},
+		{
+			name:     "unknown error",
+			err:      errors.New("something went wrong"),
+			expected: "the API request failed",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, diagnose(tc.err, tc.backend, tc.apiKey))
+		})
+	}
+}
@@ -1,19 +1,19 @@
 package logging
 
 import (
-	"os"
+	"fmt"
 	"strconv"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func Init() {
-	setLogLevel()
-	setLogFormat()
+// Init sets the log level and format of LOG_LEVEL and LOG_FORMAT.
+func Init(level, format string) {
+	setLogLevel(level)
+	setLogFormat(format)
 }
 
-func setLogFormat() {
-	format := os.Getenv("LOG_FORMAT")
+func setLogFormat(format string) {
 	if format == "json" {
 		log.SetFormatter(&log.JSONFormatter{})
 	} else {
@@ -21,21 +21,27 @@ func setLogFormat() {
 	}
 }
 
-func setLogLevel() {
-	level := os.Getenv("LOG_LEVEL")
-	if level == "" {
+func setLogLevel(level string) {
+	logLevel, err := ParseLevel(level)
+	if err != nil {
 		log.SetLevel(log.InfoLevel)
-	} else {
-		if levelInt, err := strconv.Atoi(level); err == nil {
-			log.SetLevel(log.Level(uint32(levelInt)))
-		} else {
-			levelInt, err := log.ParseLevel(level)
-			if err != nil {
-				log.SetLevel(log.InfoLevel)
-				log.Errorf("Invalid log level '%s', defaulting to info", level)
-			} else {
-				log.SetLevel(levelInt)
-			}
-		}
+		log.Errorf("Invalid log level '%s', defaulting to info", level)
+		return
+	}
+	log.SetLevel(logLevel)
+}
+
+// ParseLevel parses the log level of LOG_LEVEL, which is a name like "debug" or a number. Empty means info.
+func ParseLevel(level string) (log.Level, error) {
+	if level == "" {
+		return log.InfoLevel, nil
+	}
+	if levelInt, err := strconv.Atoi(level); err == nil {
+		return log.Level(uint32(levelInt)), nil
+	}
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return log.InfoLevel, fmt.Errorf("invalid log level '%s'", level)
 	}
+	return logLevel, nil
 }
@@ -0,0 +1,116 @@
+package reload
+
+import (
+	"context"
+	"sync"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/dnsprovider"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+// generation is a provider created from one configuration, it counts the calls in flight.
+type generation struct {
+	provider provider.Provider
+	calls    sync.WaitGroup
+}
+
+var (
+	_ provider.Provider       = (*Provider)(nil)
+	_ ionos.APIChecker        = (*Provider)(nil)
+	_ ionos.CredentialChecker = (*Provider)(nil)
+)
+
+// Provider delegates to the provider of the current configuration, which is replaced by Swap on a reload. Calls in
+// flight finish with the provider they started with.
+type Provider struct {
+	mu      sync.RWMutex
+	current *generation
+}
+
+// NewProvider returns a provider delegating to the given provider until it is swapped.
+func NewProvider(current provider.Provider) *Provider {
+	return &Provider{current: &generation{provider: current}}
+}
+
+// Swap replaces the provider. After the calls in flight of the previous provider have finished, its pending deletions
+// are handed over to the current provider and it is closed.
+func (p *Provider) Swap(next provider.Provider) {
+	p.mu.Lock()
+	previous := p.current
+	p.current = &generation{provider: next}
+	p.mu.Unlock()
+	go func() {
+		previous.calls.Wait()
+		// the next provider may have been replaced by another reload in the meantime
+		p.mu.RLock()
+		current := p.current.provider
+		p.mu.RUnlock()
+		ionos.HandOverDeletions(previous.provider, current)
+		dnsprovider.Close(previous.provider)
+	}()
+}
+
+// Close closes the current provider, e.g. on shutdown after the requests have been drained.
+func (p *Provider) Close() {
+	p.mu.RLock()
+	current := p.current.provider
+	p.mu.RUnlock()
+	dnsprovider.Close(current)
+}
+
+// acquire returns the current generation, release must be called once the call has finished.
+func (p *Provider) acquire() (*generation, func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	g := p.current
+	g.calls.Add(1)
+	return g, g.calls.Done
+}
+
+func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	g, release := p.acquire()
+	defer release()
+	return g.provider.Records(ctx)
+}
+
+func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	g, release := p.acquire()
+	defer release()
+	return g.provider.ApplyChanges(ctx, changes)
+}
+
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	g, release := p.acquire()
+	defer release()
+	return g.provider.AdjustEndpoints(endpoints)
+}
+
+func (p *Provider) GetDomainFilter() endpoint.DomainFilterInterface {
+	g, release := p.acquire()
+	defer release()
+	return g.provider.GetDomainFilter()
+}
+
+// CheckAPI checks the API of the current provider, if it supports it.
+func (p *Provider) CheckAPI(ctx context.Context) error {
+	g, release := p.acquire()
+	defer release()
+	if checker, ok := g.provider.(ionos.APIChecker); ok {
+		return checker.CheckAPI(ctx)
+	}
+	return nil
+}
+
+// CheckCredentials checks the credentials of the current provider, if it supports it.
+func (p *Provider) CheckCredentials(ctx context.Context) error {
+	g, release := p.acquire()
+	defer release()
+	if checker, ok := g.provider.(ionos.CredentialChecker); ok {
+		return checker.CheckCredentials(ctx)
+	}
+	return nil
+}
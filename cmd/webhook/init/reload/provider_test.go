@@ -0,0 +1,110 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+type mockProvider struct {
+	provider.BaseProvider
+	records  []*endpoint.Endpoint
+	checkErr error
+	started  chan struct{}
+	block    chan struct{}
+	deferred *ionos.DeferredDeletions
+	closed   atomic.Bool
+}
+
+func (m *mockProvider) Records(context.Context) ([]*endpoint.Endpoint, error) {
+	if m.block != nil {
+		close(m.started)
+		<-m.block
+	}
+	return m.records, nil
+}
+
+func (m *mockProvider) ApplyChanges(context.Context, *plan.Changes) error {
+	return nil
+}
+
+func (m *mockProvider) CheckAPI(context.Context) error {
+	return m.checkErr
+}
+
+func (m *mockProvider) DeferredDeletions() *ionos.DeferredDeletions {
+	return m.deferred
+}
+
+func (m *mockProvider) Close() {
+	m.closed.Store(true)
+}
+
+func TestProviderSwap(t *testing.T) {
+	first := &mockProvider{
+		records:  []*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", endpoint.RecordTypeA, "1.1.1.1")},
+		checkErr: fmt.Errorf("unavailable"),
+		started:  make(chan struct{}),
+		block:    make(chan struct{}),
+	}
+	second := &mockProvider{records: []*endpoint.Endpoint{endpoint.NewEndpoint("b.example.com", endpoint.RecordTypeA, "2.2.2.2")}}
+	p := NewProvider(first)
+	assert.EqualError(t, p.CheckAPI(context.Background()), "unavailable")
+	assert.NoError(t, p.CheckCredentials(context.Background()), "the provider does not check credentials")
+
+	inFlight := make(chan []*endpoint.Endpoint)
+	go func() {
+		records, _ := p.Records(context.Background())
+		inFlight <- records
+	}()
+	<-first.started
+
+	p.Swap(second)
+	records, err := p.Records(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, second.records, records)
+	assert.NoError(t, p.CheckAPI(context.Background()))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, first.closed.Load(), "the previous provider is closed after the call in flight")
+
+	close(first.block)
+	assert.Equal(t, first.records, <-inFlight, "the call in flight finishes with the previous provider")
+	assert.Eventually(t, first.closed.Load, time.Second, 10*time.Millisecond)
+	assert.False(t, second.closed.Load())
+
+	p.Close()
+	assert.True(t, second.closed.Load(), "the current provider is closed on shutdown")
+}
+
+func TestProviderSwapHandsOverDeletions(t *testing.T) {
+	newDeferred := func() *ionos.DeferredDeletions {
+		// a deletion taken over is due, because it has been planned before
+		return ionos.NewDeferredDeletions(time.Nanosecond, "", "")
+	}
+	first := &mockProvider{deferred: newDeferred(), started: make(chan struct{}), block: make(chan struct{})}
+	second := &mockProvider{deferred: newDeferred()}
+	third := &mockProvider{deferred: newDeferred()}
+	deletion := &plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", endpoint.RecordTypeA, "1.1.1.1")}}
+	first.deferred.Filter(deletion, deletion)
+	p := NewProvider(first)
+	go func() { _, _ = p.Records(context.Background()) }()
+	<-first.started
+
+	// the second provider is replaced, before the call in flight of the first one has finished
+	p.Swap(second)
+	p.Swap(third)
+	require.Eventually(t, second.closed.Load, time.Second, time.Millisecond)
+	close(first.block)
+	require.Eventually(t, first.closed.Load, time.Second, time.Millisecond)
+	assert.Len(t, third.deferred.Filter(deletion, deletion).Delete, 1, "the current provider takes over the pending deletions")
+}
@@ -0,0 +1,114 @@
+package reload
+
+import (
+	"os"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/dnsprovider"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/logging"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+var configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: ionos.MetricsNamespace,
+	Name:      "config_reloads_total",
+	Help:      "Number of configuration reloads, by result.",
+}, []string{"result"})
+
+// Reloader reloads the configuration from the config file and the environment and replaces the provider with one
+// created from the new configuration. An invalid configuration is rejected and the previous one stays in effect.
+type Reloader struct {
+	mu             sync.Mutex
+	config         configuration.Config
+	provider       *Provider
+	createProvider func(configuration.Config) (provider.Provider, error)
+	environ        func() []string
+}
+
+// New returns a reloader of the running configuration and its provider.
+func New(config configuration.Config, current provider.Provider) *Reloader {
+	return &Reloader{
+		config:         config,
+		provider:       NewProvider(current),
+		createProvider: dnsprovider.Init,
+		environ:        os.Environ,
+	}
+}
+
+// Provider returns the provider, which always delegates to the provider of the current configuration.
+func (r *Reloader) Provider() *Provider {
+	return r.provider
+}
+
+// Reload reloads the configuration, logs the outcome and records it as metric.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log.Infof("Reloading the configuration")
+	if err := r.reload(); err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		log.Errorf("Failed to reload the configuration, keeping the previous configuration: %v", err)
+		return err
+	}
+	configReloads.WithLabelValues("success").Inc()
+	log.Infof("Reloaded the configuration")
+	return nil
+}
+
+func (r *Reloader) reload() error {
+	config, err := configuration.Load(r.config.ConfigFile, r.environ())
+	if err != nil {
+		return err
+	}
+	if _, err := logging.ParseLevel(config.LogLevel); err != nil {
+		return err
+	}
+	next, err := r.createProvider(config)
+	if err != nil {
+		return err
+	}
+	for _, key := range keepServerSettings(r.config, &config) {
+		log.Warnf("%s has changed, it takes effect after a restart", key)
+	}
+	logging.Init(config.LogLevel, config.LogFormat)
+	r.provider.Swap(next)
+	r.config = config
+	return nil
+}
+
+// keepServerSettings resets the settings of the servers, which cannot be reloaded, to the running values and returns
+// the keys of the changed ones.
+func keepServerSettings(running configuration.Config, config *configuration.Config) []string {
+	var changed []string
+	keep(&changed, "SERVER_HOST", running.ServerHost, &config.ServerHost)
+	keep(&changed, "SERVER_PORT", running.ServerPort, &config.ServerPort)
+	keep(&changed, "METRICS_HOST", running.MetricsHost, &config.MetricsHost)
+	keep(&changed, "METRICS_PORT", running.MetricsPort, &config.MetricsPort)
+	keep(&changed, "SERVER_READ_TIMEOUT", running.ServerReadTimeout, &config.ServerReadTimeout)
+	keep(&changed, "SERVER_WRITE_TIMEOUT", running.ServerWriteTimeout, &config.ServerWriteTimeout)
+	keep(&changed, "READINESS_API_CHECK_INTERVAL", running.ReadinessAPICheckInterval, &config.ReadinessAPICheckInterval)
+	keep(&changed, "READINESS_CHECK_TIMEOUT", running.ReadinessCheckTimeout, &config.ReadinessCheckTimeout)
+	keep(&changed, "READINESS_MAX_SYNC_FAILURES", running.ReadinessMaxSyncFailures, &config.ReadinessMaxSyncFailures)
+	keep(&changed, "SHUTDOWN_DRAIN_TIMEOUT", running.ShutdownDrainTimeout, &config.ShutdownDrainTimeout)
+	keep(&changed, "SHUTDOWN_DELAY", running.ShutdownDelay, &config.ShutdownDelay)
+	keep(&changed, "SERVER_TLS_CERT_FILE", running.ServerTLSCertFile, &config.ServerTLSCertFile)
+	keep(&changed, "SERVER_TLS_KEY_FILE", running.ServerTLSKeyFile, &config.ServerTLSKeyFile)
+	keep(&changed, "SERVER_TLS_CLIENT_CA_FILE", running.ServerTLSClientCAFile, &config.ServerTLSClientCAFile)
+	keep(&changed, "METRICS_TLS_CERT_FILE", running.MetricsTLSCertFile, &config.MetricsTLSCertFile)
+	keep(&changed, "METRICS_TLS_KEY_FILE", running.MetricsTLSKeyFile, &config.MetricsTLSKeyFile)
+	keep(&changed, "METRICS_TLS_CLIENT_CA_FILE", running.MetricsTLSClientCAFile, &config.MetricsTLSClientCAFile)
+	return changed
+}
+
+func keep[T comparable](changed *[]string, key string, running T, value *T) {
+	if *value != running {
+		*changed = append(*changed, key)
+		*value = running
+	}
+}
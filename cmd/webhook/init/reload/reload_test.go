@@ -0,0 +1,65 @@
+package reload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
+)
+
+func TestReload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(content), 0o600))
+	}
+	writeConfig("IONOS_API_KEY: secret\nLOG_LEVEL: info\n")
+	config, err := configuration.Load(configFile, nil)
+	require.NoError(t, err)
+
+	initial := &mockProvider{}
+	var created []configuration.Config
+	r := New(config, initial)
+	r.environ = func() []string { return nil }
+	r.createProvider = func(config configuration.Config) (provider.Provider, error) {
+		if len(config.DomainFilter) > 0 && config.DomainFilter[0] == "unreachable.de" {
+			return nil, fmt.Errorf("startup check failed")
+		}
+		created = append(created, config)
+		return &mockProvider{}, nil
+	}
+	defer log.SetLevel(log.GetLevel())
+	successes := testutil.ToFloat64(configReloads.WithLabelValues("success"))
+	failures := testutil.ToFloat64(configReloads.WithLabelValues("failure"))
+
+	writeConfig("IONOS_API_KEY: secret\nLOG_LEVEL: debug\nDOMAIN_FILTER: [a.de]\nSERVER_PORT: 9999\n")
+	require.NoError(t, r.Reload())
+	require.Len(t, created, 1)
+	assert.Equal(t, []string{"a.de"}, created[0].DomainFilter)
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+	assert.Equal(t, 8888, r.config.ServerPort, "the server settings are kept until a restart")
+	assert.Eventually(t, initial.closed.Load, time.Second, 10*time.Millisecond, "the previous provider is closed")
+	assert.InDelta(t, successes+1, testutil.ToFloat64(configReloads.WithLabelValues("success")), 0)
+
+	current := r.provider.current.provider
+	for _, content := range []string{
+		"LOG_LEVEL: debug\n",
+		"IONOS_API_KEY: secret\nLOG_LEVEL: verbose\n",
+		"IONOS_API_KEY: secret\nDOMAIN_FILTER: [unreachable.de]\n",
+	} {
+		writeConfig(content)
+		assert.Error(t, r.Reload())
+	}
+	assert.Len(t, created, 1)
+	assert.Same(t, current, r.provider.current.provider, "the previous configuration stays in effect")
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+	assert.InDelta(t, failures+3, testutil.ToFloat64(configReloads.WithLabelValues("failure")), 0)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+// requestContextProvider calls the provider with the context of the webhook request, because the handlers of
+// external-dns use context.Background(). This propagates the span and the cancellation of the request. The results
+// are recorded as syncs of the readiness, the running calls are counted for the shutdown.
+type requestContextProvider struct {
+	provider.Provider
+	ctx        context.Context
+	readiness  *Readiness
+	operations *operations
+}
+
+func (p requestContextProvider) Records(context.Context) (endpoints []*endpoint.Endpoint, err error) {
+	defer p.operations.start("records")()
+	ctx, span := ionos.StartSpan(p.ctx, "Provider.Records")
+	defer span.End()
+	endpoints, err = p.Provider.Records(ctx)
+	span.SetAttributes(attribute.Int("dns.endpoint.count", len(endpoints)))
+	ionos.RecordSpanError(span, err)
+	p.readiness.RecordSync(err)
+	return endpoints, err
+}
+
+func (p requestContextProvider) ApplyChanges(_ context.Context, changes *plan.Changes) error {
+	defer p.operations.start("apply_changes")()
+	ctx, span := ionos.StartSpan(p.ctx, "Provider.ApplyChanges",
+		attribute.Int("dns.changes.create", len(changes.Create)),
+		attribute.Int("dns.changes.update", len(changes.UpdateNew)),
+		attribute.Int("dns.changes.delete", len(changes.Delete)))
+	defer span.End()
+	err := p.Provider.ApplyChanges(ctx, changes)
+	ionos.RecordSpanError(span, err)
+	p.readiness.RecordSync(err)
+	return err
+}
+
+// withRequestContext returns a handler, which serves the request with a webhook server using the request context.
+func withRequestContext(webhookServer api.WebhookServer, readiness *Readiness, operations *operations, handler func(*api.WebhookServer, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestServer := api.WebhookServer{Provider: requestContextProvider{Provider: webhookServer.Provider, ctx: r.Context(), readiness: readiness, operations: operations}}
+		handler(&requestServer, w, r)
+	}
+}
+
+// operations counts the running provider calls by operation, so that the unfinished ones can be reported on shutdown.
+type operations struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+// start counts a running call of the operation, the returned function ends it. A nil operations counts nothing.
+func (o *operations) start(operation string) func() {
+	if o == nil {
+		return func() {}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.running == nil {
+		o.running = make(map[string]int)
+	}
+	o.running[operation]++
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.running[operation]--
+	}
+}
+
+// String lists the running calls by operation, e.g. "apply_changes=1, records=2", empty if there are none.
+func (o *operations) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var running []string
+	for operation, count := range o.running {
+		if count > 0 {
+			running = append(running, fmt.Sprintf("%s=%d", operation, count))
+		}
+	}
+	sort.Strings(running)
+	return strings.Join(running, ", ")
+}
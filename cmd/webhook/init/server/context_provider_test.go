@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+)
+
+type contextRecordingProvider struct {
+	MockProvider
+	ctx context.Context
+}
+
+func (p *contextRecordingProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	p.ctx = ctx
+	return []*endpoint.Endpoint{}, nil
+}
+
+func TestRequestContextIsPropagated(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	provider := &contextRecordingProvider{}
+	router := chi.NewRouter()
+	router.Use(otelhttp.NewMiddleware("test"))
+	router.HandleFunc("/records", withRequestContext(api.WebhookServer{Provider: provider}, nil, nil, (*api.WebhookServer).RecordsHandler))
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/records", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+
+	require.NotNil(t, provider.ctx)
+	providerSpan := trace.SpanFromContext(provider.ctx).SpanContext()
+	assert.True(t, providerSpan.IsValid(), "the provider must be called with the span of the request")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "Provider.Records", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
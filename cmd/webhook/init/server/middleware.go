@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+var httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: ionos.MetricsNamespace,
+	Name:      "http_requests_total",
+	Help:      "Number of requests to the webhook, by handler, method and status code.",
+}, []string{"handler", "method", "code"})
+
+var httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: ionos.MetricsNamespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Duration of the requests to the webhook, by handler and method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"handler", "method"})
+
+var httpPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: ionos.MetricsNamespace,
+	Name:      "http_panics_total",
+	Help:      "Number of panics recovered in the handlers of the webhook.",
+}, []string{"handler"})
+
+// instrument returns the middleware of the webhook router, it assigns a request id, recovers from panics, records the
+// metrics and writes an access log entry per request.
+func instrument(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := middleware.GetReqID(r.Context())
+		w.Header().Set(requestIDHeader, requestID)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		logger := log.WithField("requestID", requestID).WithField("method", r.Method).WithField("path", r.URL.Path)
+
+		defer func() {
+			handler := routePattern(r)
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.WithField("panic", rec).Errorf("recovered from panic in handler: %s", debug.Stack())
+				httpPanics.WithLabelValues(handler).Inc()
+				if ww.Status() == 0 {
+					ww.WriteHeader(http.StatusInternalServerError)
+				}
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			duration := time.Since(start)
+			httpRequests.WithLabelValues(handler, r.Method, strconv.Itoa(status)).Inc()
+			httpRequestDuration.WithLabelValues(handler, r.Method).Observe(duration.Seconds())
+			logger = logger.WithField("status", status).WithField("duration", duration).WithField("bytes", ww.BytesWritten())
+			if status >= http.StatusInternalServerError {
+				logger.Warn("request failed")
+			} else {
+				logger.Info("request handled")
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	}))
+}
+
+// routePattern returns the matched route of the request, so that the metrics do not depend on arbitrary paths.
+func routePattern(r *http.Request) string {
+	if routeContext := chi.RouteContext(r.Context()); routeContext != nil {
+		if pattern := routeContext.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInstrumentedRouter() *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(instrument)
+	router.Get("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	router.Get("/panic", func(http.ResponseWriter, *http.Request) {
+		panic("handler failed")
+	})
+	return router
+}
+
+func TestInstrumentRecordsRequests(t *testing.T) {
+	router := newInstrumentedRouter()
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("/ok", http.MethodGet, "200"))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+	assert.NotEmpty(t, recorder.Header().Get(requestIDHeader))
+	assert.InDelta(t, before+1, testutil.ToFloat64(httpRequests.WithLabelValues("/ok", http.MethodGet, "200")), 0)
+}
+
+func TestInstrumentKeepsRequestID(t *testing.T) {
+	router := newInstrumentedRouter()
+	request := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	request.Header.Set(requestIDHeader, "external-dns-1")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, "external-dns-1", recorder.Header().Get(requestIDHeader))
+}
+
+func TestInstrumentRecoversFromPanic(t *testing.T) {
+	router := newInstrumentedRouter()
+	before := testutil.ToFloat64(httpPanics.WithLabelValues("/panic"))
+
+	recorder := httptest.NewRecorder()
+	require.NotPanics(t, func() {
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.InDelta(t, before+1, testutil.ToFloat64(httpPanics.WithLabelValues("/panic")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(httpRequests.WithLabelValues("/panic", http.MethodGet, "500")), 0)
+}
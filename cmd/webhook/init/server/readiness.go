@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	readinessStatusOK    = "ok"
+	readinessStatusError = "error"
+)
+
+// readinessCheck is a named dependency of the readiness.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// dependencyStatus is the JSON status of one dependency.
+type dependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readinessStatus is the JSON response of the readiness endpoint.
+type readinessStatus struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+}
+
+// Readiness decides whether the webhook is ready, based on its dependencies and the results of the recent syncs.
+type Readiness struct {
+	maxSyncFailures int
+	timeout         time.Duration
+	mu              sync.Mutex
+	checks          []readinessCheck
+	syncFailures    int
+	lastSyncError   error
+	shuttingDown    bool
+}
+
+// NewReadiness returns a new Readiness, which is unready after maxSyncFailures consecutive failed syncs. A maxSyncFailures
+// of 0 disables the sync check. Each check of a dependency is cancelled after the timeout.
+func NewReadiness(maxSyncFailures int, timeout time.Duration) *Readiness {
+	return &Readiness{maxSyncFailures: maxSyncFailures, timeout: timeout}
+}
+
+// AddCheck adds a dependency, which is ready as long as the check returns no error.
+func (r *Readiness) AddCheck(name string, check func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, readinessCheck{name: name, check: check})
+}
+
+// RecordSync records the result of a Records or ApplyChanges call, a successful call resets the failures.
+// A nil Readiness records nothing.
+func (r *Readiness) RecordSync(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.syncFailures = 0
+		r.lastSyncError = nil
+		return
+	}
+	r.syncFailures++
+	r.lastSyncError = err
+}
+
+// SetShuttingDown makes the webhook unready, so that no new requests are sent to it during the shutdown.
+func (r *Readiness) SetShuttingDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shuttingDown = true
+}
+
+func (r *Readiness) syncCheck(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSyncFailures > 0 && r.syncFailures >= r.maxSyncFailures {
+		return fmt.Errorf("%d consecutive syncs failed, last error: %w", r.syncFailures, r.lastSyncError)
+	}
+	return nil
+}
+
+// Status runs all checks and returns the status of each dependency and whether all of them are ready.
+func (r *Readiness) Status(ctx context.Context) (readinessStatus, bool) {
+	r.mu.Lock()
+	checks := append([]readinessCheck{{name: "sync", check: r.syncCheck}}, r.checks...)
+	shuttingDown := r.shuttingDown
+	r.mu.Unlock()
+	if shuttingDown {
+		return readinessStatus{Status: readinessStatusError, Dependencies: map[string]dependencyStatus{
+			"shutdown": {Status: readinessStatusError, Error: "the webhook is shutting down"},
+		}}, false
+	}
+
+	result := readinessStatus{Status: readinessStatusOK, Dependencies: make(map[string]dependencyStatus, len(checks))}
+	ready := true
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := c.check(checkCtx)
+		cancel()
+		if err != nil {
+			ready = false
+			result.Status = readinessStatusError
+			result.Dependencies[c.name] = dependencyStatus{Status: readinessStatusError, Error: err.Error()}
+			continue
+		}
+		result.Dependencies[c.name] = dependencyStatus{Status: readinessStatusOK}
+	}
+	return result, ready
+}
+
+// Handler answers with the JSON status of the dependencies, the status code is 503 if the webhook is not ready.
+func (r *Readiness) Handler(w http.ResponseWriter, req *http.Request) {
+	status, ready := r.Status(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		log.Warnf("webhook is not ready: %+v", status.Dependencies)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Errorf("failed to encode readiness status: %v", err)
+	}
+}
+
+// cachedCheck returns a check, which runs the given check at most once per interval and returns the cached result
+// otherwise. Concurrent callers wait for the running check.
+func cachedCheck(interval time.Duration, check func(ctx context.Context) error) func(ctx context.Context) error {
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var lastErr error
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checkedAt.IsZero() && time.Since(checkedAt) < interval {
+			return lastErr
+		}
+		lastErr = check(ctx)
+		if errors.Is(lastErr, context.Canceled) {
+			// the probe gave up, do not cache its result
+			return lastErr
+		}
+		checkedAt = time.Now()
+		return lastErr
+	}
+}
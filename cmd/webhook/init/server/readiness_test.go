@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionoscore"
+)
+
+func serveReadiness(t *testing.T, readiness *Readiness) (int, readinessStatus) {
+	response := httptest.NewRecorder()
+	readiness.Handler(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var status readinessStatus
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &status))
+	return response.Code, status
+}
+
+func TestReadinessSyncFailures(t *testing.T) {
+	readiness := NewReadiness(2, time.Second)
+
+	code, status := serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, readinessStatus{Status: "ok", Dependencies: map[string]dependencyStatus{"sync": {Status: "ok"}}}, status)
+
+	readiness.RecordSync(fmt.Errorf("first"))
+	code, _ = serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusOK, code)
+
+	readiness.RecordSync(fmt.Errorf("second"))
+	code, status = serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "error", status.Status)
+	assert.Equal(t, "2 consecutive syncs failed, last error: second", status.Dependencies["sync"].Error)
+
+	readiness.RecordSync(nil)
+	code, _ = serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadinessWithFailingCoreBackend(t *testing.T) {
+	ionosAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`[{"code":"INTERNAL_SERVER_ERROR"}]`))
+		case strings.HasSuffix(r.URL.Path, "/zones"):
+			_, _ = w.Write([]byte(`[{"id":"a","name":"a.de","type":"NATIVE"}]`))
+		default:
+			_, _ = w.Write([]byte(`{"id":"a","name":"a.de","type":"NATIVE","records":[]}`))
+		}
+	}))
+	defer ionosAPI.Close()
+	coreProvider, err := ionoscore.NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{
+		APIKey:         "prefix.secret",
+		APIEndpointURL: ionosAPI.URL,
+		AuthHeader:     "X-API-Key",
+	})
+	require.NoError(t, err)
+	failingConfig := config
+	failingConfig.ServerPort = 0
+	failingConfig.MetricsPort = 0
+	failingServers, err := Init(failingConfig, api.WebhookServer{Provider: coreProvider})
+	require.NoError(t, err)
+	defer failingServers.Shutdown()
+	webhookURL := "http://" + failingServers.webhookListener.Addr().String()
+	readyz := "http://" + failingServers.exposedListener.Addr().String() + "/readyz"
+
+	for range failingConfig.ReadinessMaxSyncFailures {
+		response, err := http.Post(webhookURL+"/records", api.MediaTypeFormatAndVersion,
+			strings.NewReader(`{"Create":[{"dnsName":"new.a.de","recordType":"A","targets":["1.1.1.1"]}]}`))
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	}
+	response, err := http.Get(readyz)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode, "the failed writes of the core backend make the webhook unready")
+	assert.Contains(t, string(body), "consecutive syncs failed, last error: failed to create records for new.a.de A")
+}
+
+func TestReadinessSyncFailuresDisabled(t *testing.T) {
+	readiness := NewReadiness(0, time.Second)
+	for i := 0; i < 10; i++ {
+		readiness.RecordSync(fmt.Errorf("failed"))
+	}
+	code, _ := serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadinessCachedAPICheck(t *testing.T) {
+	calls := 0
+	var apiErr error
+	readiness := NewReadiness(3, time.Second)
+	readiness.AddCheck("ionos_api", cachedCheck(time.Hour, func(ctx context.Context) error {
+		calls++
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return apiErr
+	}))
+
+	apiErr = fmt.Errorf("401 Unauthorized")
+	code, status := serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, dependencyStatus{Status: "error", Error: "401 Unauthorized"}, status.Dependencies["ionos_api"])
+	assert.Equal(t, dependencyStatus{Status: "ok"}, status.Dependencies["sync"])
+
+	apiErr = nil
+	code, _ = serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "the failed result must be cached")
+	assert.Equal(t, 1, calls)
+}
+
+func TestCachedCheckExpires(t *testing.T) {
+	calls := 0
+	check := cachedCheck(time.Millisecond, func(context.Context) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, check(context.Background()))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, check(context.Background()))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCachedCheckIgnoresCancelledChecks(t *testing.T) {
+	calls := 0
+	check := cachedCheck(time.Hour, func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, check(ctx), context.Canceled)
+	require.NoError(t, check(context.Background()))
+	assert.Equal(t, 2, calls)
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	readiness := NewReadiness(3, time.Second)
+	readiness.SetShuttingDown()
+
+	code, status := serveReadiness(t, readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, readinessStatus{Status: "error", Dependencies: map[string]dependencyStatus{
+		"shutdown": {Status: "error", Error: "the webhook is shutting down"},
+	}}, status)
+}
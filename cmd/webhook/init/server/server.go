@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,44 +14,119 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"sigs.k8s.io/external-dns/provider"
 	"sigs.k8s.io/external-dns/provider/webhook/api"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 )
 
+// exposedShutdownTimeout limits the shutdown of the exposed server, which serves short requests only.
+const exposedShutdownTimeout = 5 * time.Second
+
+// cancelGracePeriod is the time the requests get to return, after they have been cancelled at the drain timeout.
+const cancelGracePeriod = 5 * time.Second
+
+// Servers are the webhook server and the server of the exposed endpoints, which are shut down together.
+type Servers struct {
+	Webhook         *http.Server
+	Exposed         *http.Server
+	webhookListener net.Listener
+	exposedListener net.Listener
+	provider        provider.Provider
+	readiness       *Readiness
+	operations      *operations
+	shutdownDelay   time.Duration
+	drainTimeout    time.Duration
+	// cancelRequests cancels the contexts of all requests to the webhook server.
+	cancelRequests context.CancelFunc
+}
+
 // Init server initialization function
 // The server will respond to the following endpoints:
 // - / (GET): initialization, negotiates headers and returns the domain filter
 // - /records (GET): returns the current records
 // - /records (POST): applies the changes
 // - /adjustendpoints (POST): executes the AdjustEndpoints method
-func Init(config configuration.Config, webhookServer api.WebhookServer) *http.Server {
+// Every request gets a request id and a span, is logged and measured, panics of the handlers result in a 500 response.
+// The exposed server responds to /healthz, /readyz and /metrics.
+// Both servers serve TLS, if their certificate is configured, and verify the client certificates, if their client CA
+// is configured. The addresses are bound before Init returns, so that an address in use is returned as error.
+func Init(config configuration.Config, webhookServer api.WebhookServer) (*Servers, error) {
+	webhookTLS, err := newTLSConfig(config.ServerTLSCertFile, config.ServerTLSKeyFile, config.ServerTLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("webhook server: %w", err)
+	}
+	exposedTLS, err := newTLSConfig(config.MetricsTLSCertFile, config.MetricsTLSKeyFile, config.MetricsTLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("exposed server: %w", err)
+	}
+	readiness := NewReadiness(config.ReadinessMaxSyncFailures, config.ReadinessCheckTimeout)
+	if checker, ok := webhookServer.Provider.(ionos.APIChecker); ok {
+		readiness.AddCheck("ionos_api", cachedCheck(config.ReadinessAPICheckInterval, checker.CheckAPI))
+	}
+	if checker, ok := webhookServer.Provider.(ionos.CredentialChecker); ok {
+		readiness.AddCheck("credentials", checker.CheckCredentials)
+	}
+	running := &operations{}
+
 	rWebhook := chi.NewRouter()
+	rWebhook.Use(otelhttp.NewMiddleware("webhook", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	})), instrument)
 	rWebhook.HandleFunc("/", webhookServer.NegotiateHandler)
-	rWebhook.HandleFunc("/records", webhookServer.RecordsHandler)
+	rWebhook.HandleFunc("/records", withRequestContext(webhookServer, readiness, running, (*api.WebhookServer).RecordsHandler))
 	rWebhook.HandleFunc("/adjustendpoints", webhookServer.AdjustEndpointsHandler)
 
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
 	srvWebhook := createHTTPServer(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort), rWebhook, config.ServerReadTimeout, config.ServerWriteTimeout)
+	srvWebhook.BaseContext = func(net.Listener) context.Context { return requestCtx }
+	srvWebhook.TLSConfig = webhookTLS
+	webhookListener, err := net.Listen("tcp", srvWebhook.Addr)
+	if err != nil {
+		cancelRequests()
+		return nil, fmt.Errorf("can't start webhook server on addr: '%s': %w", srvWebhook.Addr, err)
+	}
 	go func() {
-		log.Infof("starting webhook server on addr: '%s' ", srvWebhook.Addr)
-		if err := srvWebhook.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Errorf("can't start webhook server on addr: '%s', error: %v", srvWebhook.Addr, err)
+		log.Infof("starting webhook server on addr: '%s' ", webhookListener.Addr())
+		if err := serve(srvWebhook, webhookListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("webhook server on addr: '%s' failed, error: %v", webhookListener.Addr(), err)
 		}
 	}()
 
 	rExposed := chi.NewRouter()
 	rExposed.Get("/healthz", healthCheckHandler)
+	rExposed.Get("/readyz", readiness.Handler)
 	rExposed.Get("/metrics", promhttp.Handler().ServeHTTP)
 
 	srvExposed := createHTTPServer(fmt.Sprintf("%s:%d", config.MetricsHost, config.MetricsPort), rExposed, config.ServerReadTimeout, config.ServerWriteTimeout)
+	srvExposed.TLSConfig = exposedTLS
+	exposedListener, err := net.Listen("tcp", srvExposed.Addr)
+	if err != nil {
+		cancelRequests()
+		_ = webhookListener.Close()
+		return nil, fmt.Errorf("can't start exposed server on addr: '%s': %w", srvExposed.Addr, err)
+	}
 	go func() {
-		log.Infof("starting server for exposed endpoints on addr: '%s'", srvExposed.Addr)
-		if err := srvExposed.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Errorf("can't start exposed server on addr: '%s', error: %v", srvExposed.Addr, err)
+		log.Infof("starting server for exposed endpoints on addr: '%s'", exposedListener.Addr())
+		if err := serve(srvExposed, exposedListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("exposed server on addr: '%s' failed, error: %v", exposedListener.Addr(), err)
 		}
 	}()
 
-	return srvWebhook
+	return &Servers{
+		Webhook:         srvWebhook,
+		Exposed:         srvExposed,
+		webhookListener: webhookListener,
+		exposedListener: exposedListener,
+		provider:        webhookServer.Provider,
+		readiness:       readiness,
+		operations:      running,
+		shutdownDelay:   config.ShutdownDelay,
+		drainTimeout:    config.ShutdownDrainTimeout,
+		cancelRequests:  cancelRequests,
+	}, nil
 }
 
 func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout time.Duration) *http.Server {
@@ -62,17 +138,74 @@ func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout
 	}
 }
 
-// ShutdownGracefully gracefully shutdown the http server
-func ShutdownGracefully(srv *http.Server) {
+// serve serves TLS, if the server has a TLS configuration, whose certificate is provided by GetCertificate.
+func serve(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(listener, "", "")
+	}
+	return srv.Serve(listener)
+}
+
+// ShutdownGracefully waits for a termination signal and shuts down the servers. SIGHUP calls reload and keeps the
+// servers running, unless reload is nil.
+func ShutdownGracefully(servers *Servers, reload func()) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	sig := <-sigCh
-	log.Infof("shutting down server due to received signal: %v", sig)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Errorf("error shutting down server: %v", err)
+	for sig == syscall.SIGHUP && reload != nil {
+		reload()
+		sig = <-sigCh
+	}
+	log.Infof("shutting down servers due to received signal: %v", sig)
+	servers.Shutdown()
+}
+
+// Shutdown makes the webhook unready and shuts down the webhook server after the shutdown delay. Its running requests
+// get the drain timeout to finish before they are cancelled. Afterwards the provider is closed, which flushes the
+// audit log. The exposed server is shut down last, so that the readiness is reported until then. The unfinished
+// operations are logged at the end.
+func (s *Servers) Shutdown() {
+	s.readiness.SetShuttingDown()
+	if s.shutdownDelay > 0 {
+		log.Infof("waiting %s for the webhook to be removed from the endpoints, before shutting down", s.shutdownDelay)
+		time.Sleep(s.shutdownDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	err := s.Webhook.Shutdown(ctx)
+	cancelled := ""
+	if errors.Is(err, context.DeadlineExceeded) {
+		cancelled = s.operations.String()
+		log.Warnf("requests are still running after the drain timeout of %s, cancelling them", s.drainTimeout)
+		s.cancelRequests()
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), cancelGracePeriod)
+		err = s.Webhook.Shutdown(graceCtx)
+		graceCancel()
+	}
+	if err != nil {
+		log.Errorf("error shutting down webhook server: %v", err)
+		_ = s.Webhook.Close()
+	}
+	s.cancelRequests()
+	if closer, ok := s.provider.(interface{ Close() }); ok {
+		closer.Close()
+	}
+
+	exposedCtx, exposedCancel := context.WithTimeout(context.Background(), exposedShutdownTimeout)
+	defer exposedCancel()
+	if err := s.Exposed.Shutdown(exposedCtx); err != nil {
+		log.Errorf("error shutting down exposed server: %v", err)
+		_ = s.Exposed.Close()
+	}
+
+	switch abandoned := s.operations.String(); {
+	case abandoned != "":
+		log.Errorf("shutdown completed, operations cancelled after the drain timeout: %s, still running: %s", cancelled, abandoned)
+	case cancelled != "":
+		log.Warnf("shutdown completed, operations cancelled after the drain timeout: %s", cancelled)
+	default:
+		log.Infof("shutdown completed, all operations finished")
 	}
-	cancel()
 }
 
 func healthCheckHandler(w http.ResponseWriter, _ *http.Request) {
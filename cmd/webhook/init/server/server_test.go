@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -42,18 +47,22 @@ type testCase struct {
 var (
 	mockProvider *MockProvider
 	config       configuration.Config
+	servers      *Servers
 )
 
 func TestMain(m *testing.M) {
 	mockProvider = &MockProvider{}
-	config = configuration.Init()
-	srv := Init(config, api.WebhookServer{Provider: mockProvider})
-	go ShutdownGracefully(srv)
-	time.Sleep(300 * time.Millisecond)
-	m.Run()
-	if err := srv.Shutdown(context.TODO()); err != nil {
-		panic(err)
+	// the validation fails without credentials, which the server does not need
+	config, _ = configuration.Load("", os.Environ())
+	var err error
+	servers, err = Init(config, api.WebhookServer{Provider: mockProvider})
+	if err != nil {
+		log.Fatalf("failed to start the servers: %v", err)
 	}
+	go ShutdownGracefully(servers, nil)
+	code := m.Run()
+	servers.Shutdown()
+	os.Exit(code)
 }
 
 func TestRecords(t *testing.T) {
@@ -276,6 +285,32 @@ func TestMetricsServer(t *testing.T) {
 	assert.Contains(t, body, fmt.Sprintf(`go_info{version="%s"}`, runtime.Version()))
 }
 
+func TestReadinessServer(t *testing.T) {
+	getReadiness := func() (int, string) {
+		response, err := http.Get(fmt.Sprintf("http://%s:%d/readyz", config.MetricsHost, config.MetricsPort))
+		require.NoError(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+		res, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(res)
+	}
+	// the previous tests leave failed syncs behind, a successful sync resets them
+	defer servers.readiness.RecordSync(nil)
+
+	servers.readiness.RecordSync(nil)
+	code, body := getReadiness()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"sync":{"status":"ok"}`)
+
+	for range config.ReadinessMaxSyncFailures {
+		servers.readiness.RecordSync(fmt.Errorf("failed"))
+	}
+	code, body = getReadiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, `"sync":{"status":"error","error":"3 consecutive syncs failed, last error: failed"}`)
+}
+
 func executeTestCases(t *testing.T, testCases []testCase) {
 	log.SetLevel(log.DebugLevel)
 	for i, tc := range testCases {
@@ -351,3 +386,80 @@ func (d *MockProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpo
 func (d *MockProvider) GetDomainFilter() endpoint.DomainFilterInterface {
 	return d.testCase.returnDomainFilter
 }
+
+type blockingProvider struct {
+	MockProvider
+	started   chan struct{}
+	cancelled chan error
+	closed    atomic.Bool
+}
+
+func (p *blockingProvider) ApplyChanges(ctx context.Context, _ *plan.Changes) error {
+	close(p.started)
+	<-ctx.Done()
+	p.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func (p *blockingProvider) Close() {
+	p.closed.Store(true)
+}
+
+func TestShutdown(t *testing.T) {
+	hook := logtest.NewGlobal()
+	shutdownConfig := config
+	shutdownConfig.ServerPort = 0
+	shutdownConfig.MetricsPort = 0
+	shutdownConfig.ShutdownDelay = 500 * time.Millisecond
+	shutdownConfig.ShutdownDrainTimeout = 100 * time.Millisecond
+	provider := &blockingProvider{started: make(chan struct{}), cancelled: make(chan error, 1)}
+	servers, err := Init(shutdownConfig, api.WebhookServer{Provider: provider})
+	require.NoError(t, err)
+	webhookURL := "http://" + servers.webhookListener.Addr().String()
+	readyz := "http://" + servers.exposedListener.Addr().String() + "/readyz"
+
+	go func() {
+		response, err := http.Post(webhookURL+"/records", api.MediaTypeFormatAndVersion, strings.NewReader(`{"Create":[]}`))
+		if err == nil {
+			_ = response.Body.Close()
+		}
+	}()
+	<-provider.started
+	done := make(chan struct{})
+	go func() {
+		servers.Shutdown()
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		response, err := http.Get(readyz)
+		if err != nil {
+			return false
+		}
+		defer response.Body.Close()
+		return response.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond, "the webhook is unready while the requests are drained")
+	response, err := http.Get(webhookURL + "/")
+	require.NoError(t, err, "the webhook accepts requests during the shutdown delay")
+	_ = response.Body.Close()
+	assert.False(t, provider.closed.Load())
+
+	assert.ErrorIs(t, <-provider.cancelled, context.Canceled, "the running apply is cancelled after the drain timeout")
+	<-done
+	assert.True(t, provider.closed.Load(), "the provider is closed after the requests have been drained")
+	_, err = http.Get(readyz)
+	assert.Error(t, err, "the exposed server is shut down")
+	assert.Equal(t, "shutdown completed, operations cancelled after the drain timeout: apply_changes=1", hook.LastEntry().Message)
+}
+
+func TestInitWithAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	inUseConfig := config
+	inUseConfig.ServerHost = "127.0.0.1"
+	inUseConfig.ServerPort = listener.Addr().(*net.TCPAddr).Port
+
+	_, err = Init(inUseConfig, api.WebhookServer{Provider: &MockProvider{}})
+	assert.ErrorContains(t, err, "can't start webhook server on addr: '"+listener.Addr().String()+"'")
+}
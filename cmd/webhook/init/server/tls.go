@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tlsReloadInterval is the minimum time between two checks of the TLS files for changes.
+var tlsReloadInterval = 10 * time.Second
+
+// newTLSConfig returns the TLS configuration of a server, or nil without certificate file. The certificate, the key
+// and the client CAs are reloaded, when their files change. With a client CA file the clients must present a
+// certificate signed by one of its CAs.
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	certificate, err := newFileReloader("TLS certificate", func() (*tls.Certificate, error) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate '%s': %w", certFile, err)
+		}
+		return &certificate, nil
+	}, watchedFile{"TLS certificate", certFile}, watchedFile{"TLS key", keyFile})
+	if err != nil {
+		return nil, err
+	}
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return certificate.Get(), nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate,
+	}
+	if clientCAFile == "" {
+		return tlsConfig, nil
+	}
+	// the configuration of a handshake is replaced with the client CAs, so that a changed client CA file applies to the
+	// next handshake
+	clientConfig, err := newFileReloader("client CA", func() (*tls.Config, error) {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file '%s': %w", clientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA file '%s' contains no PEM encoded certificates", clientCAFile)
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: getCertificate,
+			ClientCAs:      pool,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+		}, nil
+	}, watchedFile{"client CA", clientCAFile})
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return clientConfig.Get(), nil
+	}
+	return tlsConfig, nil
+}
+
+// watchedFile is a file checked for changes by fileReloader, the description is used in the errors.
+type watchedFile struct {
+	description string
+	name        string
+}
+
+// fileReloader loads a value from files and reloads it, when the modification time of one of the files changes. The
+// files are checked at most once per tlsReloadInterval, so that a handshake usually only reads the current value. A
+// value, which fails to load, is logged and the previous one is returned further.
+type fileReloader[T any] struct {
+	description string
+	files       []watchedFile
+	load        func() (*T, error)
+	interval    time.Duration
+	now         func() time.Time
+	value       atomic.Pointer[T]
+	// nextCheck is the time in unix nanoseconds, after which the files are checked again
+	nextCheck atomic.Int64
+	mu        sync.Mutex
+	modTimes  []time.Time
+}
+
+func newFileReloader[T any](description string, load func() (*T, error), files ...watchedFile) (*fileReloader[T], error) {
+	r := &fileReloader[T]{
+		description: description,
+		files:       files,
+		load:        load,
+		interval:    tlsReloadInterval,
+		now:         time.Now,
+		modTimes:    make([]time.Time, len(files)),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.nextCheck.Store(r.now().Add(r.interval).UnixNano())
+	return r, nil
+}
+
+// Get returns the current value, it is called for every TLS handshake. Once the interval has passed, one of the
+// callers checks the files, while the others return the current value.
+func (r *fileReloader[T]) Get() *T {
+	now := r.now()
+	if now.UnixNano() >= r.nextCheck.Load() && r.mu.TryLock() {
+		r.nextCheck.Store(now.Add(r.interval).UnixNano())
+		if err := r.reload(); err != nil {
+			log.Errorf("failed to reload the %s, using the previous one: %v", r.description, err)
+		}
+		r.mu.Unlock()
+	}
+	return r.value.Load()
+}
+
+// reload loads the value, if one of the files has changed since the last load. The caller must hold the lock except
+// during the construction.
+func (r *fileReloader[T]) reload() error {
+	modTimes := make([]time.Time, len(r.files))
+	changed := r.value.Load() == nil
+	for i, file := range r.files {
+		info, err := os.Stat(file.name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s file '%s': %w", file.description, file.name, err)
+		}
+		modTimes[i] = info.ModTime()
+		changed = changed || !modTimes[i].Equal(r.modTimes[i])
+	}
+	if !changed {
+		return nil
+	}
+	// the files are not loaded again until they change, so that a broken file is logged once
+	r.modTimes = modTimes
+	value, err := r.load()
+	if err != nil {
+		return err
+	}
+	if r.value.Swap(value) != nil {
+		log.Infof("reloaded the %s from '%s'", r.description, r.files[0].name)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/certtest"
+)
+
+// tlsClient returns a client, which trusts the CA files, presents the optional client certificate and opens a new
+// connection per request.
+func tlsClient(t *testing.T, clientCert *tls.Certificate, caFiles ...string) *http.Client {
+	pool := x509.NewCertPool()
+	for _, caFile := range caFiles {
+		caPEM, err := os.ReadFile(caFile)
+		require.NoError(t, err)
+		require.True(t, pool.AppendCertsFromPEM(caPEM))
+	}
+	tlsConfig := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+}
+
+// replaceFile writes the content of the source file to the target file with a later modification time.
+func replaceFile(t *testing.T, source, target string) {
+	content, err := os.ReadFile(source)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(target, content, 0o600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(target, modTime, modTime))
+}
+
+func TestTLS(t *testing.T) {
+	defer func(interval time.Duration) { tlsReloadInterval = interval }(tlsReloadInterval)
+	tlsReloadInterval = 0
+	dir := t.TempDir()
+	serverCert, serverKey := certtest.WriteCertificate(t, dir, "server")
+	clientCA, clientKey := certtest.WriteCertificate(t, dir, "client")
+	clientCert, err := tls.LoadX509KeyPair(clientCA, clientKey)
+	require.NoError(t, err)
+
+	tlsConfig := config
+	tlsConfig.ServerPort = 0
+	tlsConfig.MetricsPort = 0
+	tlsConfig.ServerTLSCertFile = serverCert
+	tlsConfig.ServerTLSKeyFile = serverKey
+	tlsConfig.ServerTLSClientCAFile = clientCA
+	tlsConfig.MetricsTLSCertFile = serverCert
+	tlsConfig.MetricsTLSKeyFile = serverKey
+	tlsServers, err := Init(tlsConfig, api.WebhookServer{Provider: &MockProvider{}})
+	require.NoError(t, err)
+	defer tlsServers.Shutdown()
+	// the certificate is valid for localhost, the listeners may be bound to all addresses
+	webhookAddr := fmt.Sprintf("localhost:%d", tlsServers.webhookListener.Addr().(*net.TCPAddr).Port)
+	exposedAddr := fmt.Sprintf("localhost:%d", tlsServers.exposedListener.Addr().(*net.TCPAddr).Port)
+
+	response, err := tlsClient(t, &clientCert, serverCert).Get("https://" + webhookAddr + "/")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "server", response.TLS.PeerCertificates[0].Subject.CommonName)
+
+	_, err = tlsClient(t, nil, serverCert).Get("https://" + webhookAddr + "/")
+	assert.Error(t, err, "the webhook server requires a client certificate")
+
+	response, err = tlsClient(t, nil, serverCert).Get("https://" + exposedAddr + "/healthz")
+	require.NoError(t, err, "the exposed server does not require a client certificate")
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, err = http.Get("http://" + exposedAddr + "/healthz")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "plain HTTP is rejected")
+
+	// the renewed certificate is served without a restart
+	renewedCert, renewedKey := certtest.WriteCertificate(t, t.TempDir(), "server")
+	replaceFile(t, renewedCert, serverCert)
+	replaceFile(t, renewedKey, serverKey)
+	_, err = tlsClient(t, &clientCert, clientCA).Get("https://" + webhookAddr + "/")
+	assert.Error(t, err, "the previous certificate is not trusted by the client")
+	response, err = tlsClient(t, &clientCert, renewedCert).Get("https://" + webhookAddr + "/")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// the renewed client CA is trusted without a restart
+	renewedClientCA, renewedClientKey := certtest.WriteCertificate(t, t.TempDir(), "client")
+	renewedClientCert, err := tls.LoadX509KeyPair(renewedClientCA, renewedClientKey)
+	require.NoError(t, err)
+	replaceFile(t, renewedClientCA, clientCA)
+	_, err = tlsClient(t, &clientCert, renewedCert).Get("https://" + webhookAddr + "/")
+	assert.Error(t, err, "the client certificate of the previous CA is rejected")
+	response, err = tlsClient(t, &renewedClientCert, renewedCert).Get("https://" + webhookAddr + "/")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsConfig, err := newTLSConfig("", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig, "TLS is disabled without certificate")
+
+	dir := t.TempDir()
+	certFile, keyFile := certtest.WriteCertificate(t, dir, "server")
+	tlsConfig, err = newTLSConfig(certFile, keyFile, certFile)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	for _, tc := range []struct {
+		certFile, keyFile, clientCAFile string
+		expectedError                   string
+	}{
+		{"/does/not/exist", keyFile, "", "failed to read TLS certificate file '/does/not/exist': stat /does/not/exist: no such file or directory"},
+		{keyFile, keyFile, "", "failed to load TLS certificate '" + keyFile + "': tls: failed to find certificate PEM data in certificate input, but did find a private key; PEM inputs may have been switched"},
+		{certFile, keyFile, "/does/not/exist", "failed to read client CA file '/does/not/exist': stat /does/not/exist: no such file or directory"},
+		{certFile, keyFile, keyFile, "client CA file '" + keyFile + "' contains no PEM encoded certificates"},
+	} {
+		_, err := newTLSConfig(tc.certFile, tc.keyFile, tc.clientCAFile)
+		assert.EqualError(t, err, tc.expectedError)
+	}
+}
+
+func TestFileReloader(t *testing.T) {
+	certFile, keyFile := certtest.WriteCertificate(t, t.TempDir(), "server")
+	loads := 0
+	reloader, err := newFileReloader("TLS certificate", func() (*tls.Certificate, error) {
+		loads++
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &certificate, err
+	}, watchedFile{"TLS certificate", certFile}, watchedFile{"TLS key", keyFile})
+	require.NoError(t, err)
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	previous := reloader.Get()
+	require.NotNil(t, previous)
+
+	renewedCert, renewedKey := certtest.WriteCertificate(t, t.TempDir(), "server")
+	replaceFile(t, renewedCert, certFile)
+	replaceFile(t, renewedKey, keyFile)
+	assert.Same(t, previous, reloader.Get(), "the files are not checked before the interval has passed")
+	assert.Equal(t, 1, loads)
+
+	now = now.Add(tlsReloadInterval)
+	renewed := reloader.Get()
+	assert.NotSame(t, previous, renewed)
+	assert.Equal(t, 2, loads)
+	assert.Same(t, renewed, reloader.Get(), "unchanged files are not loaded again")
+	now = now.Add(tlsReloadInterval)
+	assert.Same(t, renewed, reloader.Get())
+	assert.Equal(t, 2, loads)
+
+	// the previous certificate is served, if the new one cannot be loaded
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	modTime := now.Add(time.Hour)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	now = now.Add(tlsReloadInterval)
+	assert.Same(t, renewed, reloader.Get())
+	assert.Equal(t, 3, loads)
+	now = now.Add(tlsReloadInterval)
+	assert.Same(t, renewed, reloader.Get())
+	assert.Equal(t, 3, loads, "a broken file is not loaded again until it changes")
+}
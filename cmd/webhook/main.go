@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/configuration"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/dnsprovider"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/logging"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/reload"
 	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/server"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/cmd/webhook/init/tracing"
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/external-dns/provider/webhook/api"
 )
@@ -26,14 +34,51 @@ var (
 	Gitsha  = "?"
 )
 
+// exitCodeStartupCheck is the exit code, if the startup check of the IONOS API failed.
+const exitCodeStartupCheck = 3
+
 func main() {
+	config, err := configuration.Init(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if config.PrintConfig {
+		// printed before the validation, so that invalid configurations can be inspected
+		if printErr := config.Print(os.Stdout); printErr != nil {
+			log.Fatalf("Failed to print configuration: %v", printErr)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if config.PrintConfig {
+		return
+	}
 	fmt.Printf(banner, Version, Gitsha)
-	logging.Init()
-	config := configuration.Init()
+	logging.Init(config.LogLevel, config.LogFormat)
+	ionos.SetBuildInfo(Version, Gitsha)
+	shutdownTracing, err := tracing.Init(context.Background(), Version)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 	provider, err := dnsprovider.Init(config)
+	var startupCheckErr *dnsprovider.StartupCheckError
+	if errors.As(err, &startupCheckErr) {
+		log.Error(err)
+		os.Exit(exitCodeStartupCheck)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize DNS provider: %v", err)
 	}
-	srv := server.Init(config, api.WebhookServer{Provider: provider})
-	server.ShutdownGracefully(srv)
+	reloader := reload.New(config, provider)
+	servers, err := server.Init(config, api.WebhookServer{Provider: reloader.Provider()})
+	if err != nil {
+		log.Fatalf("Failed to start the servers: %v", err)
+	}
+	server.ShutdownGracefully(servers, func() { _ = reloader.Reload() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
+	}
 }
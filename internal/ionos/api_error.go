@@ -0,0 +1,37 @@
+package ionos
+
+import "context"
+
+// APIChecker is implemented by the providers, which can verify the reachability of their API and their credentials.
+type APIChecker interface {
+	CheckAPI(ctx context.Context) error
+}
+
+// APIKeyProvider is implemented by the providers, which obtain their API key themselves, e.g. with username and
+// password.
+type APIKeyProvider interface {
+	APIKey() string
+}
+
+// APIError is an error response of the IONOS API with its HTTP status code.
+type APIError struct {
+	StatusCode int
+	Err        error
+}
+
+// NewAPIError returns err with the status code of the response, it returns err unchanged if it is nil or if there
+// was no response.
+func NewAPIError(statusCode int, err error) error {
+	if err == nil || statusCode == 0 {
+		return err
+	}
+	return &APIError{StatusCode: statusCode, Err: err}
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
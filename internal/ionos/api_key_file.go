@@ -0,0 +1,98 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadSecretFile returns the secret in the file, e.g. a mounted Kubernetes secret. Surrounding whitespace is removed.
+func ReadSecretFile(fileName string) (string, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file '%s': %w", fileName, err)
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("secret file '%s' is empty", fileName)
+	}
+	return secret, nil
+}
+
+// WatchAPIKeyFile watches the directory of the API key file in the background until the context is done, and calls
+// rotate with the new key whenever it differs from the current one. The file is read every interval as well, in case
+// an event is missed or the directory cannot be watched. rotate validates the key before it is used and returns an
+// error for an invalid key. If the file cannot be read or the key is invalid, the current key stays in use.
+func WatchAPIKeyFile(ctx context.Context, fileName string, interval time.Duration, currentKey string,
+	rotate func(ctx context.Context, apiKey string) error,
+) {
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		// Kubernetes replaces a mounted secret by swapping a symlink in its directory, so the directory is watched
+		if err = watcher.Add(filepath.Dir(fileName)); err != nil {
+			_ = watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Warnf("failed to watch API key file '%s', reading it every %s: %v", fileName, interval, err)
+		watcher = nil
+	} else {
+		events, watchErrors = watcher.Events, watcher.Errors
+		log.Infof("watching API key file '%s'", fileName)
+	}
+	go func() {
+		if watcher != nil {
+			defer watcher.Close()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		failing := false
+		rejectedKey := ""
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-watchErrors:
+				log.Debugf("error watching API key file '%s': %v", fileName, err)
+				continue
+			case <-events:
+			case <-ticker.C:
+			}
+			apiKey, err := ReadSecretFile(fileName)
+			if err != nil {
+				// log a failing file once, it may be in the middle of being replaced
+				if !failing {
+					log.Warnf("keeping the current API key: %v", err)
+					apiKeyRotations.WithLabelValues("failure").Inc()
+				}
+				failing = true
+				continue
+			}
+			failing = false
+			if apiKey == currentKey {
+				continue
+			}
+			if err := rotate(ctx, apiKey); err != nil {
+				// log an invalid key once, it is validated again until it is accepted or replaced
+				if apiKey != rejectedKey {
+					log.Errorf("keeping the current API key, the key in file '%s' is invalid: %v", fileName, err)
+					apiKeyRotations.WithLabelValues("invalid").Inc()
+				}
+				rejectedKey = apiKey
+				continue
+			}
+			currentKey = apiKey
+			rejectedKey = ""
+			apiKeyRotations.WithLabelValues("success").Inc()
+			log.Infof("rotated the API key from file '%s'", fileName)
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSecretFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(fileName, []byte(" prefix.secret\n"), 0o600))
+	apiKey, err := ReadSecretFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, "prefix.secret", apiKey)
+
+	require.NoError(t, os.WriteFile(fileName, []byte("\n"), 0o600))
+	_, err = ReadSecretFile(fileName)
+	assert.EqualError(t, err, "secret file '"+fileName+"' is empty")
+}
+
+func TestWatchAPIKeyFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(fileName, []byte("old"), 0o600))
+	rotated := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	successBefore := testutil.ToFloat64(apiKeyRotations.WithLabelValues("success"))
+	failureBefore := testutil.ToFloat64(apiKeyRotations.WithLabelValues("failure"))
+	invalidBefore := testutil.ToFloat64(apiKeyRotations.WithLabelValues("invalid"))
+
+	// the interval is too long for the test, the changes are noticed by watching the file
+	WatchAPIKeyFile(ctx, fileName, time.Hour, "old", func(_ context.Context, apiKey string) error {
+		if apiKey == "invalid" {
+			return fmt.Errorf("401 Unauthorized")
+		}
+		rotated <- apiKey
+		return nil
+	})
+
+	// a missing file keeps the current key
+	require.NoError(t, os.Remove(fileName))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(apiKeyRotations.WithLabelValues("failure")) == failureBefore+1
+	}, time.Second, time.Millisecond)
+
+	// an invalid key keeps the current key
+	require.NoError(t, os.WriteFile(fileName, []byte("invalid"), 0o600))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(apiKeyRotations.WithLabelValues("invalid")) == invalidBefore+1
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, rotated)
+
+	require.NoError(t, os.WriteFile(fileName, []byte("new\n"), 0o600))
+	select {
+	case apiKey := <-rotated:
+		assert.Equal(t, "new", apiKey)
+	case <-time.After(time.Second):
+		t.Fatal("the API key was not rotated")
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(apiKeyRotations.WithLabelValues("success")) == successBefore+1
+	}, time.Second, time.Millisecond)
+
+	// an unchanged key is not rotated again
+	require.NoError(t, os.WriteFile(fileName, []byte("new"), 0o600))
+	assert.Never(t, func() bool { return len(rotated) > 0 }, 50*time.Millisecond, time.Millisecond)
+	assert.Equal(t, invalidBefore+1, testutil.ToFloat64(apiKeyRotations.WithLabelValues("invalid")))
+}
+
+func TestWatchAPIKeyFileWithoutEvents(t *testing.T) {
+	// a file in a missing directory cannot be watched, it is read every interval
+	fileName := filepath.Join(t.TempDir(), "missing", "api-key")
+	rotated := make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	WatchAPIKeyFile(ctx, fileName, time.Millisecond, "old", func(_ context.Context, apiKey string) error {
+		rotated <- apiKey
+		return nil
+	})
+	require.NoError(t, os.Mkdir(filepath.Dir(fileName), 0o700))
+	require.NoError(t, os.WriteFile(fileName, []byte("new"), 0o600))
+	select {
+	case apiKey := <-rotated:
+		assert.Equal(t, "new", apiKey)
+	case <-time.After(time.Second):
+		t.Fatal("the API key was not rotated")
+	}
+}
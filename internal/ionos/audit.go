@@ -0,0 +1,297 @@
+package ionos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	// AuditStdout as audit log destination writes the audit entries to stdout.
+	AuditStdout = "stdout"
+
+	AuditActionPlan   = "plan"
+	AuditActionCreate = "create"
+	AuditActionDelete = "delete"
+	// AuditActionCreateZone is the creation of a missing zone.
+	AuditActionCreateZone = "create_zone"
+
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+	auditResultDryRun  = "dry-run"
+)
+
+type planIDKey struct{}
+
+// WithPlanID returns a context with a new random plan id, which links the audit entries of one ApplyChanges call.
+func WithPlanID(ctx context.Context) context.Context {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return context.WithValue(ctx, planIDKey{}, hex.EncodeToString(id))
+}
+
+// PlanID returns the plan id of the context, an empty string if there is none.
+func PlanID(ctx context.Context) string {
+	id, _ := ctx.Value(planIDKey{}).(string)
+	return id
+}
+
+// AuditRecord is the value of a record before or after a change.
+type AuditRecord struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      int32  `json:"ttl,omitempty"`
+	Priority int32  `json:"priority,omitempty"`
+}
+
+// AuditChanges summarizes the plan of an ApplyChanges call.
+type AuditChanges struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	PlanID   string        `json:"planId,omitempty"`
+	Backend  string        `json:"backend"`
+	Action   string        `json:"action"`
+	Zone     string        `json:"zone,omitempty"`
+	ZoneID   string        `json:"zoneId,omitempty"`
+	RecordID string        `json:"recordId,omitempty"`
+	Before   *AuditRecord  `json:"before,omitempty"`
+	After    *AuditRecord  `json:"after,omitempty"`
+	Changes  *AuditChanges `json:"changes,omitempty"`
+	Result   string        `json:"result"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// AuditLog writes every DNS mutation as JSON line to stdout or to a file, independent of the log level.
+// A nil AuditLog writes nothing.
+type AuditLog struct {
+	backend string
+	dryRun  bool
+	now     func() time.Time
+	mu      sync.Mutex
+	writer  io.Writer
+}
+
+// NewAuditLog returns a new AuditLog writing to the destination, which is either AuditStdout or a file name.
+// The file is rotated when it exceeds maxSizeMB, keeping maxBackups rotated files. Audit logs of the same file share
+// it, e.g. the providers of the previous and the new configuration during a reload. It returns nil if the destination
+// is empty.
+func NewAuditLog(destination string, maxSizeMB, maxBackups int, backend string, dryRun bool) (*AuditLog, error) {
+	if destination == "" {
+		return nil, nil
+	}
+	auditLog := &AuditLog{backend: backend, dryRun: dryRun, now: time.Now}
+	if destination == AuditStdout {
+		auditLog.writer = os.Stdout
+		return auditLog, nil
+	}
+	writer, err := openSharedFile(destination, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file '%s': %w", destination, err)
+	}
+	auditLog.writer = writer
+	return auditLog, nil
+}
+
+// LogPlan writes an entry summarizing the changes of the plan in the context.
+func (a *AuditLog) LogPlan(ctx context.Context, changes *plan.Changes) {
+	if a == nil || changes == nil {
+		return
+	}
+	a.Log(ctx, AuditEntry{
+		Action: AuditActionPlan,
+		Changes: &AuditChanges{
+			Create: len(changes.Create),
+			Update: len(changes.UpdateNew),
+			Delete: len(changes.Delete),
+		},
+	}, nil)
+}
+
+// Log completes the entry with time, plan id, backend and the result of err and writes it.
+func (a *AuditLog) Log(ctx context.Context, entry AuditEntry, err error) {
+	if a == nil {
+		return
+	}
+	entry.Time = a.now().UTC()
+	entry.PlanID = PlanID(ctx)
+	entry.Backend = a.backend
+	switch {
+	case err != nil:
+		entry.Result = auditResultFailure
+		entry.Error = err.Error()
+	case a.dryRun:
+		entry.Result = auditResultDryRun
+	default:
+		entry.Result = auditResultSuccess
+	}
+	line, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		log.Errorf("failed to encode audit entry: %v", jsonErr)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.writer.Write(append(line, '\n')); err != nil {
+		log.Errorf("failed to write audit entry %s: %v", line, err)
+	}
+}
+
+// Close releases the audit log file, which is closed when no other audit log shares it. Stdout is kept open. Entries
+// logged afterwards are dropped.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, ok := a.writer.(*sharedFile)
+	a.writer = io.Discard
+	if !ok {
+		return nil
+	}
+	return file.release()
+}
+
+// sharedFiles are the open audit log files by name.
+var (
+	sharedFilesMu sync.Mutex
+	sharedFiles   = map[string]*sharedFile{}
+)
+
+// sharedFile is a rotating file shared by the audit logs of the same file, which serializes their writes, so that
+// the entries are not interleaved and the file is rotated once.
+type sharedFile struct {
+	fileName string
+	mu       sync.Mutex
+	file     *rotatingFile
+	refs     int
+}
+
+// openSharedFile opens the file or shares it, if it is open already. The size and backup settings of the last opener
+// apply.
+func openSharedFile(fileName string, maxSize int64, maxBackups int) (*sharedFile, error) {
+	fileName = filepath.Clean(fileName)
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+	if shared, ok := sharedFiles[fileName]; ok {
+		shared.mu.Lock()
+		shared.file.maxSize = maxSize
+		shared.file.maxBackups = maxBackups
+		shared.mu.Unlock()
+		shared.refs++
+		return shared, nil
+	}
+	file, err := newRotatingFile(fileName, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	shared := &sharedFile{fileName: fileName, file: file, refs: 1}
+	sharedFiles[fileName] = shared
+	return shared, nil
+}
+
+func (s *sharedFile) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Write(p)
+}
+
+// release closes the file, once it is released by all audit logs sharing it.
+func (s *sharedFile) release() error {
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(sharedFiles, s.fileName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// rotatingFile is an append-only file, which is renamed to <name>.1 when it exceeds the max size. Older files are
+// shifted to <name>.2 and so on, up to the max number of backups.
+type rotatingFile struct {
+	fileName   string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(fileName string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{fileName: fileName, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.fileName); err != nil {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", r.fileName, i), fmt.Sprintf("%s.%d", r.fileName, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.fileName, r.fileName+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
@@ -0,0 +1,159 @@
+package ionos
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func readAuditEntries(t *testing.T, fileName string) []AuditEntry {
+	t.Helper()
+	file, err := os.Open(fileName)
+	require.NoError(t, err)
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	auditLog, err := NewAuditLog("", 0, 0, "test", false)
+	require.NoError(t, err)
+	assert.Nil(t, auditLog)
+	auditLog.LogPlan(context.Background(), &plan.Changes{})
+	auditLog.Log(context.Background(), AuditEntry{Action: AuditActionCreate}, nil)
+	assert.NoError(t, auditLog.Close())
+}
+
+func TestAuditLog(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(fileName, 10, 1, "test", false)
+	require.NoError(t, err)
+	auditLog.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+	ctx := WithPlanID(context.Background())
+	require.NotEmpty(t, PlanID(ctx))
+	auditLog.LogPlan(ctx, &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a.de", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("b.de", "A", "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("b.de", "A", "2.2.2.2")},
+	})
+	auditLog.Log(ctx, AuditEntry{
+		Action:   AuditActionDelete,
+		Zone:     "b.de",
+		ZoneID:   "bZoneId",
+		RecordID: "1",
+		Before:   &AuditRecord{Name: "b.de", Type: "A", Content: "1.1.1.1", TTL: 300},
+	}, nil)
+	auditLog.Log(ctx, AuditEntry{
+		Action: AuditActionCreate,
+		Zone:   "b.de",
+		ZoneID: "bZoneId",
+		After:  &AuditRecord{Name: "b.de", Type: "A", Content: "2.2.2.2", TTL: 300},
+	}, errors.New("api error"))
+
+	entries := readAuditEntries(t, fileName)
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, PlanID(ctx), entry.PlanID)
+		assert.Equal(t, "test", entry.Backend)
+		assert.Equal(t, "2024-01-01T12:00:00Z", entry.Time.Format(time.RFC3339))
+	}
+	assert.Equal(t, AuditActionPlan, entries[0].Action)
+	assert.Equal(t, &AuditChanges{Create: 1, Update: 1}, entries[0].Changes)
+	assert.Equal(t, "success", entries[1].Result)
+	assert.Equal(t, "1.1.1.1", entries[1].Before.Content)
+	assert.Equal(t, "failure", entries[2].Result)
+	assert.Equal(t, "api error", entries[2].Error)
+
+	require.NoError(t, auditLog.Close())
+	auditLog.Log(ctx, AuditEntry{Action: AuditActionCreate}, nil)
+	assert.Len(t, readAuditEntries(t, fileName), 3, "entries after closing are dropped")
+}
+
+func TestAuditLogDryRun(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(fileName, 10, 1, "test", true)
+	require.NoError(t, err)
+	auditLog.Log(context.Background(), AuditEntry{Action: AuditActionCreate}, nil)
+	entries := readAuditEntries(t, fileName)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "dry-run", entries[0].Result)
+}
+
+func TestAuditLogInvalidFile(t *testing.T) {
+	_, err := NewAuditLog(filepath.Join(t.TempDir(), "missing", "audit.log"), 10, 1, "test", false)
+	require.ErrorContains(t, err, "failed to open audit log file")
+}
+
+func TestAuditLogSharesFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	previous, err := NewAuditLog(fileName, 10, 1, "test", false)
+	require.NoError(t, err)
+	next, err := NewAuditLog(fileName, 10, 1, "test", false)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, auditLog := range []*AuditLog{previous, next} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				auditLog.Log(context.Background(), AuditEntry{Action: AuditActionCreate, Zone: "a.de"}, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, previous.Close())
+	next.Log(context.Background(), AuditEntry{Action: AuditActionDelete, Zone: "a.de"}, nil)
+	require.NoError(t, next.Close())
+
+	entries := readAuditEntries(t, fileName)
+	require.Len(t, entries, 201, "the entries are not interleaved")
+	assert.Equal(t, AuditActionDelete, entries[200].Action, "the file stays open, until the last audit log is closed")
+	assert.NotContains(t, sharedFiles, fileName)
+}
+
+func TestRotatingFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	file, err := newRotatingFile(fileName, 10, 2)
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	read := func(name string) string {
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "fourth\n", read(fileName))
+	assert.Equal(t, "third\n", read(fileName+".1"))
+	assert.Equal(t, "second\n", read(fileName+".2"))
+	_, err = os.Stat(fileName + ".3")
+	assert.True(t, os.IsNotExist(err), "only two backups are kept")
+
+	// an existing file is appended to
+	file, err = newRotatingFile(fileName, 100, 2)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("fifth\n"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(read(fileName), "fourth\nfifth\n"))
+}
@@ -0,0 +1,54 @@
+package ionos
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProviderSelection selects the backend of the webhook, either explicitly or by the format of the API key.
+type ProviderSelection string
+
+const (
+	// ProviderAuto selects the IONOS Cloud API if the API key is a JWT and the IONOS Hosting API otherwise.
+	ProviderAuto ProviderSelection = "auto"
+	// ProviderCore selects the IONOS Hosting API.
+	ProviderCore ProviderSelection = BackendCore
+	// ProviderCloud selects the IONOS Cloud API.
+	ProviderCloud ProviderSelection = BackendCloud
+)
+
+// UnmarshalText parses and validates the provider selection.
+func (p *ProviderSelection) UnmarshalText(text []byte) error {
+	switch selection := ProviderSelection(strings.ToLower(strings.TrimSpace(string(text)))); selection {
+	case ProviderAuto, ProviderCore, ProviderCloud:
+		*p = selection
+		return nil
+	default:
+		return fmt.Errorf("invalid provider '%s', must be '%s', '%s' or '%s'", text, ProviderCore, ProviderCloud, ProviderAuto)
+	}
+}
+
+// ParseJWTClaims returns the claims of a JWT without verifying its signature. The error explains why the token is not
+// a JWT.
+func ParseJWTClaims(token string) (map[string]any, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("it has %d instead of 3 dot separated segments", len(segments))
+	}
+	encodedPayload := strings.TrimRight(segments[1], "=")
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		// tolerate tokens encoded with the standard alphabet
+		payload, err = base64.RawStdEncoding.DecodeString(encodedPayload)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("its payload is not base64 encoded: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("its payload is not a JSON object: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,62 @@
+package ionos
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderSelectionUnmarshalText(t *testing.T) {
+	var selection ProviderSelection
+	require.NoError(t, selection.UnmarshalText([]byte(" Cloud ")))
+	assert.Equal(t, ProviderCloud, selection)
+	require.EqualError(t, selection.UnmarshalText([]byte("hosting")), "invalid provider 'hosting', must be 'core', 'cloud' or 'auto'")
+}
+
+func TestParseJWTClaims(t *testing.T) {
+	cases := []struct {
+		name           string
+		token          string
+		expectedClaims map[string]any
+		expectedError  string
+	}{
+		{
+			name:           "url encoded payload",
+			token:          "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"~~~~"}`)) + ".signature",
+			expectedClaims: map[string]any{"sub": "~~~~"},
+		},
+		{
+			name:           "padded standard encoded payload",
+			token:          "header." + base64.StdEncoding.EncodeToString([]byte(`{"exp":1}`)) + ".signature",
+			expectedClaims: map[string]any{"exp": float64(1)},
+		},
+		{
+			name:          "api key of the hosting api",
+			token:         "prefix.secret",
+			expectedError: "it has 2 instead of 3 dot separated segments",
+		},
+		{
+			name:          "payload not base64 encoded",
+			token:         "header.!!.signature",
+			expectedError: "its payload is not base64 encoded: illegal base64 data at input byte 0",
+		},
+		{
+			name:          "payload not json",
+			token:         "header." + base64.RawURLEncoding.EncodeToString([]byte("[1]")) + ".signature",
+			expectedError: "its payload is not a JSON object: json: cannot unmarshal array into Go value of type map[string]interface {}",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := ParseJWTClaims(tc.token)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedClaims, claims)
+		})
+	}
+}
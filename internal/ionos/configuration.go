@@ -1,10 +1,128 @@
 package ionos
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
 // Configuration holds configuration from environmental variables
 type Configuration struct {
-	APIKey         string `env:"IONOS_API_KEY,notEmpty"`
-	APIEndpointURL string `env:"IONOS_API_URL"`
-	AuthHeader     string `env:"IONOS_AUTH_HEADER"`
-	Debug          bool   `env:"IONOS_DEBUG" envDefault:"false"`
-	DryRun         bool   `env:"DRY_RUN" envDefault:"false"`
+	APIKey                    string            `env:"IONOS_API_KEY"`
+	APIKeyFile                string            `env:"IONOS_API_KEY_FILE"`
+	APIKeyFileInterval        time.Duration     `env:"IONOS_API_KEY_FILE_INTERVAL" envDefault:"30s"`
+	Username                  string            `env:"IONOS_USERNAME"`
+	UsernameFile              string            `env:"IONOS_USERNAME_FILE"`
+	Password                  string            `env:"IONOS_PASSWORD"`
+	PasswordFile              string            `env:"IONOS_PASSWORD_FILE"`
+	AuthAPIURL                string            `env:"IONOS_AUTH_API_URL" envDefault:"https://api.ionos.com/auth/v1"`
+	TokenTTL                  time.Duration     `env:"IONOS_TOKEN_TTL" envDefault:"1h"`
+	Provider                  ProviderSelection `env:"IONOS_PROVIDER" envDefault:"auto"`
+	AccountsFile              string            `env:"IONOS_ACCOUNTS_FILE"`
+	APIEndpointURL            string            `env:"IONOS_API_URL"`
+	AuthHeader                string            `env:"IONOS_AUTH_HEADER"`
+	APITimeout                time.Duration     `env:"IONOS_API_TIMEOUT" envDefault:"30s"`
+	SyncTimeout               time.Duration     `env:"IONOS_SYNC_TIMEOUT" envDefault:"5m"`
+	CAFile                    string            `env:"IONOS_CA_FILE"`
+	ProxyURL                  string            `env:"IONOS_PROXY_URL"`
+	ClientCertFile            string            `env:"IONOS_CLIENT_CERT_FILE"`
+	ClientKeyFile             string            `env:"IONOS_CLIENT_KEY_FILE"`
+	MaxIdleConnsPerHost       int               `env:"IONOS_MAX_IDLE_CONNS_PER_HOST" envDefault:"10"`
+	MaxConnsPerHost           int               `env:"IONOS_MAX_CONNS_PER_HOST" envDefault:"0"`
+	IdleConnTimeout           time.Duration     `env:"IONOS_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	Debug                     bool              `env:"IONOS_DEBUG" envDefault:"false"`
+	DebugMaxBodySize          int               `env:"IONOS_DEBUG_MAX_BODY_SIZE" envDefault:"0"`
+	DryRun                    bool              `env:"DRY_RUN" envDefault:"false"`
+	ZoneIDFilter              []string          `env:"ZONE_ID_FILTER"`
+	ZoneNameFilter            []string          `env:"ZONE_NAME_FILTER"`
+	ExcludeZoneNameFilter     []string          `env:"EXCLUDE_ZONE_NAME_FILTER"`
+	ZoneDiscoveryInterval     time.Duration     `env:"IONOS_ZONE_DISCOVERY_INTERVAL" envDefault:"10m"`
+	ZoneAutoCreatePatterns    []string          `env:"IONOS_ZONE_AUTO_CREATE_PATTERNS"`
+	ZoneAutoCreateTimeout     time.Duration     `env:"IONOS_ZONE_AUTO_CREATE_TIMEOUT" envDefault:"5m"`
+	ZoneAutoCreateDelegation  bool              `env:"IONOS_ZONE_AUTO_CREATE_DELEGATION" envDefault:"false"`
+	ProtectedRecords          []ProtectionRule  `env:"PROTECTED_RECORDS"`
+	DeletionGuardMaxCount     int               `env:"DELETION_GUARD_MAX_COUNT" envDefault:"0"`
+	DeletionGuardMaxPercent   float64           `env:"DELETION_GUARD_MAX_PERCENT" envDefault:"0"`
+	DeletionGuardMode         DeletionGuardMode `env:"DELETION_GUARD_MODE" envDefault:"plan"`
+	DeletionGuardOverrideFile string            `env:"DELETION_GUARD_OVERRIDE_FILE"`
+	DeletionGracePeriod       time.Duration     `env:"DELETION_GRACE_PERIOD" envDefault:"0"`
+	DeletionStateFile         string            `env:"DELETION_STATE_FILE"`
+	AuditLog                  string            `env:"AUDIT_LOG"`
+	AuditLogMaxSizeMB         int               `env:"AUDIT_LOG_MAX_SIZE_MB" envDefault:"100"`
+	AuditLogMaxBackups        int               `env:"AUDIT_LOG_MAX_BACKUPS" envDefault:"5"`
+	ProtectApexNS             bool              `env:"PROTECT_APEX_NS" envDefault:"true"`
+	StartupCheck              bool              `env:"IONOS_STARTUP_CHECK" envDefault:"false"`
+	StartupCheckTimeout       time.Duration     `env:"IONOS_STARTUP_CHECK_TIMEOUT" envDefault:"30s"`
+	CredentialExpiryWarnings  []time.Duration   `env:"IONOS_CREDENTIAL_EXPIRY_WARNINGS" envDefault:"168h,24h,1h"`
+
+	// Account is the name of the account of IONOS_ACCOUNTS_FILE, which the configuration belongs to. It labels the
+	// metrics of the account and is empty without accounts file.
+	Account string
+}
+
+// ValidateCredentials checks that either an API key or username and password are set, each of them either as value or
+// as file. With an accounts file the credentials are set per account and none of them must be set.
+func (c *Configuration) ValidateCredentials() error {
+	if c.AccountsFile != "" {
+		if set := c.credentialVariables(); len(set) > 0 {
+			return fmt.Errorf("IONOS_ACCOUNTS_FILE must not be combined with %s, the credentials are set per account", strings.Join(set, ", "))
+		}
+		return nil
+	}
+	return ValidateCredentialSettings(
+		CredentialSetting{Name: "IONOS_API_KEY", FileName: "IONOS_API_KEY_FILE", Value: c.APIKey, File: c.APIKeyFile},
+		CredentialSetting{Name: "IONOS_USERNAME", FileName: "IONOS_USERNAME_FILE", Value: c.Username, File: c.UsernameFile},
+		CredentialSetting{Name: "IONOS_PASSWORD", FileName: "IONOS_PASSWORD_FILE", Value: c.Password, File: c.PasswordFile})
+}
+
+// CredentialSetting is a credential, which is set either as value or as file. The names of both settings are used in
+// the validation errors.
+type CredentialSetting struct {
+	Name     string
+	FileName string
+	Value    string
+	File     string
+}
+
+func (s CredentialSetting) isSet() bool {
+	return s.Value != "" || s.File != ""
+}
+
+// ValidateCredentialSettings checks that either the API key or username and password are set, each of them either as
+// value or as file. It is shared by the configuration and the accounts of the accounts file.
+func ValidateCredentialSettings(apiKey, username, password CredentialSetting) error {
+	for _, setting := range []CredentialSetting{apiKey, username, password} {
+		if setting.Value != "" && setting.File != "" {
+			return fmt.Errorf("only one of %s and %s must be set", setting.Name, setting.FileName)
+		}
+	}
+	switch {
+	case username.isSet() != password.isSet():
+		return fmt.Errorf("%s and %s must be set together", username.Name, password.Name)
+	case apiKey.isSet() && username.isSet():
+		return fmt.Errorf("only one of %s and %s must be set", apiKey.Name, username.Name)
+	case !apiKey.isSet() && !username.isSet():
+		return fmt.Errorf("%s, %s or %s and %s must be set", apiKey.Name, apiKey.FileName, username.Name, password.Name)
+	}
+	return nil
+}
+
+// credentialVariables returns the names of the credential variables, which are set.
+func (c *Configuration) credentialVariables() []string {
+	var set []string
+	for name, value := range map[string]string{
+		"IONOS_API_KEY":       c.APIKey,
+		"IONOS_API_KEY_FILE":  c.APIKeyFile,
+		"IONOS_USERNAME":      c.Username,
+		"IONOS_USERNAME_FILE": c.UsernameFile,
+		"IONOS_PASSWORD":      c.Password,
+		"IONOS_PASSWORD_FILE": c.PasswordFile,
+	} {
+		if value != "" {
+			set = append(set, name)
+		}
+	}
+	sort.Strings(set)
+	return set
 }
@@ -0,0 +1,133 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CredentialChecker is implemented by the providers, which can verify that their credentials are still valid.
+type CredentialChecker interface {
+	CheckCredentials(ctx context.Context) error
+}
+
+// CredentialExpiry monitors the expiry of a JWT. It exports the remaining time as metric and logs a warning once per
+// threshold the remaining time falls below. A token without exp claim and a nil CredentialExpiry never expire.
+type CredentialExpiry struct {
+	account    string
+	thresholds []time.Duration
+	now        func() time.Time
+	mu         sync.Mutex
+	expiresAt  time.Time
+	warned     int
+	expired    bool
+}
+
+// NewCredentialExpiry returns a new CredentialExpiry for the exp claim of the token, the thresholds define when
+// warnings are logged. The account labels the metric.
+func NewCredentialExpiry(token string, thresholds []time.Duration, account string) *CredentialExpiry {
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	c := &CredentialExpiry{account: account, thresholds: sorted, now: time.Now}
+	c.SetToken(token)
+	return c
+}
+
+// SetToken replaces the monitored token, e.g. after a rotation, and resets the warnings.
+func (c *CredentialExpiry) SetToken(token string) {
+	if c == nil {
+		return
+	}
+	expiresAt, ok := TokenExpiry(token)
+	if ok {
+		log.Infof("the API token expires at %s", expiresAt.Format(time.RFC3339))
+	} else {
+		log.Debug("the API token does not expire")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expiresAt = expiresAt
+	c.warned = 0
+	c.expired = false
+}
+
+// TokenExpiry returns the time of the exp claim of the JWT.
+func TokenExpiry(token string) (time.Time, bool) {
+	claims, err := ParseJWTClaims(token)
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// Observe updates the metric and logs a warning, if the remaining time fell below a further threshold, or an error
+// once the token has expired.
+func (c *CredentialExpiry) Observe() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expiresAt.IsZero() {
+		credentialExpiry.DeleteLabelValues(c.account)
+		return
+	}
+	remaining := c.expiresAt.Sub(c.now())
+	credentialExpiry.WithLabelValues(c.account).Set(remaining.Seconds())
+	if remaining <= 0 {
+		if !c.expired {
+			log.Errorf("the API token expired at %s, all requests to the IONOS API will fail", c.expiresAt.Format(time.RFC3339))
+			c.expired = true
+		}
+		return
+	}
+	crossed := c.warned
+	for crossed < len(c.thresholds) && remaining <= c.thresholds[crossed] {
+		crossed++
+	}
+	if crossed > c.warned {
+		log.Warnf("the API token expires in %s at %s", remaining.Round(time.Second), c.expiresAt.Format(time.RFC3339))
+		c.warned = crossed
+	}
+}
+
+// StartMonitoring observes the expiry once and then periodically in the background until the context is done.
+func (c *CredentialExpiry) StartMonitoring(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	c.Observe()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.Observe()
+			}
+		}
+	}()
+}
+
+// Check returns an error if the token has expired.
+func (c *CredentialExpiry) Check(context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.expiresAt.IsZero() && !c.now().Before(c.expiresAt) {
+		return fmt.Errorf("the API token expired at %s", c.expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
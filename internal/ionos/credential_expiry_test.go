@@ -0,0 +1,138 @@
+package ionos
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tokenWithPayload(payload string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestCredentialExpiryWithoutExpiry(t *testing.T) {
+	for _, token := range []string{"prefix.secret", tokenWithPayload(`{"sub":"user"}`)} {
+		expiry := NewCredentialExpiry(token, nil, "")
+		expiry.Observe()
+		assert.NoError(t, expiry.Check(context.Background()))
+		assert.Equal(t, 0, testutil.CollectAndCount(credentialExpiry))
+	}
+
+	var expiry *CredentialExpiry
+	expiry.SetToken(tokenWithPayload(`{"exp":1}`))
+	expiry.Observe()
+	assert.NoError(t, expiry.Check(context.Background()))
+}
+
+func TestCredentialExpiry(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	expiresAt := time.Unix(1_800_000_000, 0)
+	expiry := NewCredentialExpiry(tokenWithPayload(fmt.Sprintf(`{"exp":%d}`, expiresAt.Unix())), []time.Duration{time.Hour, 24 * time.Hour}, "")
+	require.NotNil(t, expiry)
+	now := expiresAt.Add(-48 * time.Hour)
+	expiry.now = func() time.Time { return now }
+
+	expiry.Observe()
+	assert.InDelta(t, (48 * time.Hour).Seconds(), testutil.ToFloat64(credentialExpiry.WithLabelValues("")), 0)
+	assert.Equal(t, 0, countLevel(hook, log.WarnLevel))
+	assert.NoError(t, expiry.Check(context.Background()))
+
+	now = expiresAt.Add(-23 * time.Hour)
+	expiry.Observe()
+	expiry.Observe()
+	assert.Equal(t, 1, countLevel(hook, log.WarnLevel), "a threshold is warned about once")
+
+	now = expiresAt.Add(-time.Minute)
+	expiry.Observe()
+	assert.Equal(t, 2, countLevel(hook, log.WarnLevel))
+	assert.NoError(t, expiry.Check(context.Background()))
+
+	now = expiresAt.Add(time.Minute)
+	expiry.Observe()
+	expiry.Observe()
+	assert.Equal(t, 2, countLevel(hook, log.WarnLevel))
+	assert.Equal(t, 1, countLevel(hook, log.ErrorLevel), "the expiry is logged once")
+	assert.InDelta(t, -60, testutil.ToFloat64(credentialExpiry.WithLabelValues("")), 0)
+	assert.EqualError(t, expiry.Check(context.Background()), "the API token expired at "+expiresAt.Format(time.RFC3339))
+
+	// a rotated token resets the expiry
+	expiry.SetToken(tokenWithPayload(fmt.Sprintf(`{"exp":%d}`, now.Add(48*time.Hour).Unix())))
+	expiry.Observe()
+	assert.NoError(t, expiry.Check(context.Background()))
+	assert.InDelta(t, (48 * time.Hour).Seconds(), testutil.ToFloat64(credentialExpiry.WithLabelValues("")), 0)
+
+	// a rotated token without expiry removes the metric instead of exporting 0
+	expiry.SetToken("prefix.secret")
+	expiry.Observe()
+	assert.Equal(t, 0, testutil.CollectAndCount(credentialExpiry))
+}
+
+func TestCredentialExpiryOfSeveralAccounts(t *testing.T) {
+	expiring := NewCredentialExpiry(tokenWithPayload(`{"exp":1800000000}`), nil, "a")
+	expiring.now = func() time.Time { return time.Unix(1_799_999_000, 0) }
+	expiring.Observe()
+	NewCredentialExpiry("prefix.secret", nil, "b").Observe()
+
+	// the account without expiry does not remove the metric of the other account
+	assert.InDelta(t, 1000, testutil.ToFloat64(credentialExpiry.WithLabelValues("a")), 0)
+	assert.Equal(t, 1, testutil.CollectAndCount(credentialExpiry))
+	credentialExpiry.DeleteLabelValues("a")
+}
+
+func TestCredentialExpiryStopsMonitoring(t *testing.T) {
+	expiry := NewCredentialExpiry(tokenWithPayload(`{"exp":1800000000}`), nil, "")
+	observed := make(chan struct{}, 10)
+	expiry.now = func() time.Time {
+		select {
+		case observed <- struct{}{}:
+		default:
+		}
+		return time.Unix(1_700_000_000, 0)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	expiry.StartMonitoring(ctx, time.Millisecond)
+	<-observed
+	<-observed
+	cancel()
+	require.Eventually(t, func() bool {
+		// drain the observations, which happened before the cancellation was noticed
+		for len(observed) > 0 {
+			<-observed
+		}
+		time.Sleep(10 * time.Millisecond)
+		return len(observed) == 0
+	}, time.Second, time.Millisecond, "the monitoring stops with the context")
+}
+
+func TestCredentialExpiryWarnsOnceForSeveralThresholds(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	expiresAt := time.Now().Add(30 * time.Minute)
+	expiry := NewCredentialExpiry(tokenWithPayload(fmt.Sprintf(`{"exp":%d}`, expiresAt.Unix())), []time.Duration{time.Hour, 24 * time.Hour}, "")
+	require.NotNil(t, expiry)
+
+	expiry.Observe()
+	expiry.Observe()
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, 1, countLevel(hook, log.WarnLevel))
+}
+
+func countLevel(hook *logtest.Hook, level log.Level) int {
+	count := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == level {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,272 @@
+package ionos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// pendingDeletion is a deletion held back by DeferredDeletions, it is persisted in the state file.
+type pendingDeletion struct {
+	DNSName       string    `json:"dnsName"`
+	RecordType    string    `json:"recordType"`
+	SetIdentifier string    `json:"setIdentifier,omitempty"`
+	Targets       []string  `json:"targets"`
+	Since         time.Time `json:"since"`
+}
+
+// deferredDeletionsState is the content of the state file.
+type deferredDeletionsState struct {
+	Pending []*pendingDeletion `json:"pending"`
+}
+
+// DeferredDeletions holds back deletions for a grace period, so that records of flapping sources are not deleted and
+// recreated. A deletion is executed, if it is part of every plan until the grace period is over. It is cancelled, if a
+// plan does not contain it anymore. Syncs without plan do not cancel deletions, as external-dns does not apply empty
+// plans and reads the records more than once per sync with its cache or with several accounts. The pending deletions
+// are persisted in the state file, if one is configured. A nil DeferredDeletions defers nothing.
+type DeferredDeletions struct {
+	gracePeriod time.Duration
+	stateFile   string
+	account     string
+	now         func() time.Time
+	mu          sync.Mutex
+	pending     map[string]*pendingDeletion
+}
+
+// NewDeferredDeletions returns a new DeferredDeletions, it is disabled if the grace period is not positive.
+// The pending deletions of a previous run are read from the state file. The account labels the metric.
+func NewDeferredDeletions(gracePeriod time.Duration, stateFile, account string) *DeferredDeletions {
+	if gracePeriod <= 0 {
+		return nil
+	}
+	d := &DeferredDeletions{
+		gracePeriod: gracePeriod,
+		stateFile:   stateFile,
+		account:     account,
+		now:         time.Now,
+		pending:     make(map[string]*pendingDeletion),
+	}
+	if err := d.load(); err != nil {
+		log.Warnf("failed to read pending deletions from state file '%s', starting without: %v", stateFile, err)
+	}
+	pendingDeletions.WithLabelValues(d.account).Set(float64(len(d.pending)))
+	return d
+}
+
+// Filter tracks the deletions planned by external-dns and returns a copy of the changes approved by the deletion guard,
+// which only contains the deletions whose grace period is over. guarded is nil, if the guard refused the whole plan.
+// Deletions seen for the first time become pending, pending deletions missing in the plan are cancelled. The returned
+// deletions stay pending until Done is called, so that refused or failed deletions are executed with the next plan.
+func (d *DeferredDeletions) Filter(planned, guarded *plan.Changes) *plan.Changes {
+	if d == nil || planned == nil {
+		return guarded
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	seen := make(map[string]bool, len(planned.Delete))
+	due := make(map[string]bool, len(planned.Delete))
+	for _, ep := range planned.Delete {
+		key := deletionKey(ep)
+		seen[key] = true
+		logger := log.WithField("record", ep.DNSName).WithField("type", ep.RecordType)
+		deletion, ok := d.pending[key]
+		if !ok {
+			deletion = &pendingDeletion{
+				DNSName:       ep.DNSName,
+				RecordType:    ep.RecordType,
+				SetIdentifier: ep.SetIdentifier,
+				Targets:       ep.Targets,
+				Since:         now,
+			}
+			d.pending[key] = deletion
+			logger.Infof("deferring deletion of %v for %s", ep.Targets, d.gracePeriod)
+			continue
+		}
+		if remaining := deletion.Since.Add(d.gracePeriod).Sub(now); remaining > 0 {
+			logger.Debugf("deletion of %v is pending for another %s", ep.Targets, remaining.Round(time.Second))
+			continue
+		}
+		due[key] = true
+	}
+	for key, deletion := range d.pending {
+		if !seen[key] {
+			d.cancel(key, deletion)
+		}
+	}
+	d.save()
+	if guarded == nil {
+		return nil
+	}
+	filtered := *guarded
+	filtered.Delete = make([]*endpoint.Endpoint, 0, len(guarded.Delete))
+	for _, ep := range guarded.Delete {
+		if due[deletionKey(ep)] {
+			log.WithField("record", ep.DNSName).WithField("type", ep.RecordType).
+				Infof("grace period is over, deleting %v", ep.Targets)
+			filtered.Delete = append(filtered.Delete, ep)
+		}
+	}
+	return &filtered
+}
+
+// Done removes the pending deletion of the endpoint, after its records have been deleted. Endpoints without pending
+// deletion are ignored.
+func (d *DeferredDeletions) Done(ep *endpoint.Endpoint) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := deletionKey(ep)
+	if _, ok := d.pending[key]; !ok {
+		return
+	}
+	delete(d.pending, key)
+	deferredDeletionsExecuted.WithLabelValues(d.account).Inc()
+	d.save()
+}
+
+// DeletionDeferrer is implemented by the providers, which hold back deletions.
+type DeletionDeferrer interface {
+	DeferredDeletions() *DeferredDeletions
+}
+
+// DeletionsHandover is implemented by the providers combining several providers, which hand over the pending
+// deletions of each of them.
+type DeletionsHandover interface {
+	TakeOverDeletions(previous provider.Provider)
+}
+
+// HandOverDeletions hands the pending deletions of the previous provider over to the next one, which replaces it on a
+// reload, so that their grace period continues.
+func HandOverDeletions(previous, next provider.Provider) {
+	if handover, ok := next.(DeletionsHandover); ok {
+		handover.TakeOverDeletions(previous)
+		return
+	}
+	previousDeferrer, ok := previous.(DeletionDeferrer)
+	if !ok {
+		return
+	}
+	if nextDeferrer, ok := next.(DeletionDeferrer); ok {
+		nextDeferrer.DeferredDeletions().TakeOver(previousDeferrer.DeferredDeletions())
+	}
+}
+
+// TakeOver adds the pending deletions of the previous DeferredDeletions and saves them. A deletion pending in both
+// keeps the earlier start of its grace period.
+func (d *DeferredDeletions) TakeOver(previous *DeferredDeletions) {
+	if d == nil || previous == nil || d == previous {
+		return
+	}
+	previous.mu.Lock()
+	pending := make(map[string]*pendingDeletion, len(previous.pending))
+	for key, deletion := range previous.pending {
+		pending[key] = deletion
+	}
+	previous.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, deletion := range pending {
+		if existing, ok := d.pending[key]; !ok || deletion.Since.Before(existing.Since) {
+			d.pending[key] = deletion
+		}
+	}
+	if len(pending) > 0 {
+		log.Infof("took over %d pending deletions of the previous configuration", len(pending))
+	}
+	d.save()
+}
+
+// cancel removes a pending deletion, the caller must hold the lock.
+func (d *DeferredDeletions) cancel(key string, deletion *pendingDeletion) {
+	log.WithField("record", deletion.DNSName).WithField("type", deletion.RecordType).
+		Infof("record is desired again, cancelling deletion of %v", deletion.Targets)
+	delete(d.pending, key)
+	deferredDeletionsCancelled.WithLabelValues(d.account).Inc()
+}
+
+func (d *DeferredDeletions) load() error {
+	if d.stateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(d.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state deferredDeletionsState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return err
+	}
+	for _, deletion := range state.Pending {
+		ep := endpoint.NewEndpoint(deletion.DNSName, deletion.RecordType, deletion.Targets...)
+		ep.SetIdentifier = deletion.SetIdentifier
+		d.pending[deletionKey(ep)] = deletion
+	}
+	log.Infof("read %d pending deletions from state file '%s'", len(d.pending), d.stateFile)
+	return nil
+}
+
+// save writes the pending deletions to the state file and updates the metric, the caller must hold the lock.
+func (d *DeferredDeletions) save() {
+	pendingDeletions.WithLabelValues(d.account).Set(float64(len(d.pending)))
+	if d.stateFile == "" {
+		return
+	}
+	state := deferredDeletionsState{Pending: make([]*pendingDeletion, 0, len(d.pending))}
+	for _, deletion := range d.pending {
+		state.Pending = append(state.Pending, deletion)
+	}
+	sort.Slice(state.Pending, func(i, j int) bool {
+		return state.Pending[i].DNSName+state.Pending[i].RecordType < state.Pending[j].DNSName+state.Pending[j].RecordType
+	})
+	if err := writeFileAtomic(d.stateFile, state); err != nil {
+		log.Errorf("failed to write pending deletions to state file '%s': %v", d.stateFile, err)
+	}
+}
+
+// writeFileAtomic writes the value as json to a temporary file and renames it, so that readers never see a partial file.
+func writeFileAtomic(fileName string, value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
+// deletionKey identifies the deletion of an endpoint independent of the order of its targets.
+func deletionKey(ep *endpoint.Endpoint) string {
+	targets := make([]string, len(ep.Targets))
+	copy(targets, ep.Targets)
+	sort.Strings(targets)
+	return fmt.Sprintf("%s/%s/%s/%s", normalizeName(ep.DNSName), ep.RecordType, ep.SetIdentifier, strings.Join(targets, ","))
+}
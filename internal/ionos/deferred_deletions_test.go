@@ -0,0 +1,210 @@
+package ionos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestDeferredDeletions(t *testing.T, stateFile string) (*DeferredDeletions, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	d := NewDeferredDeletions(5*time.Minute, stateFile, "")
+	require.NotNil(t, d)
+	d.now = clock.Now
+	return d, clock
+}
+
+func deleteChanges(endpoints ...*endpoint.Endpoint) *plan.Changes {
+	return &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.a.de", "A", "9.9.9.9")},
+		Delete: endpoints,
+	}
+}
+
+// filterUnguarded filters the changes as if the deletion guard approved all of them.
+func filterUnguarded(d *DeferredDeletions, changes *plan.Changes) *plan.Changes {
+	return d.Filter(changes, changes)
+}
+
+func TestDeferredDeletionsDisabled(t *testing.T) {
+	d := NewDeferredDeletions(0, "", "")
+	assert.Nil(t, d)
+	changes := deleteChanges(endpoint.NewEndpoint("a.de", "A", "1.1.1.1"))
+	assert.Same(t, changes, filterUnguarded(d, changes))
+}
+
+func TestDeferredDeletionsGracePeriod(t *testing.T) {
+	d, clock := newTestDeferredDeletions(t, "")
+	ep := endpoint.NewEndpoint("a.de", "A", "1.1.1.1", "2.2.2.2")
+
+	filtered := filterUnguarded(d, deleteChanges(ep))
+	assert.Empty(t, filtered.Delete)
+	assert.Len(t, filtered.Create, 1, "other changes must not be deferred")
+
+	clock.now = clock.now.Add(4 * time.Minute)
+	assert.Empty(t, filterUnguarded(d, deleteChanges(ep)).Delete)
+
+	clock.now = clock.now.Add(time.Minute)
+	// targets in a different order identify the same deletion
+	filtered = filterUnguarded(d, deleteChanges(endpoint.NewEndpoint("a.de", "A", "2.2.2.2", "1.1.1.1")))
+	require.Len(t, filtered.Delete, 1)
+	assert.Len(t, d.pending, 1, "the deletion is pending until it is done")
+	d.Done(filtered.Delete[0])
+	assert.Empty(t, d.pending)
+}
+
+func TestDeferredDeletionsRefusedByGuard(t *testing.T) {
+	d, clock := newTestDeferredDeletions(t, "")
+	a := endpoint.NewEndpoint("a.de", "A", "1.1.1.1")
+	b := endpoint.NewEndpoint("b.de", "A", "2.2.2.2")
+
+	filterUnguarded(d, deleteChanges(a, b))
+	clock.now = clock.now.Add(5 * time.Minute)
+
+	// the guard refuses the whole plan
+	assert.Nil(t, d.Filter(deleteChanges(a, b), nil))
+	assert.Len(t, d.pending, 2, "refused deletions stay pending")
+
+	// the guard refuses the deletions of a
+	filtered := d.Filter(deleteChanges(a, b), deleteChanges(b))
+	require.Len(t, filtered.Delete, 1)
+	assert.Equal(t, "b.de", filtered.Delete[0].DNSName)
+	d.Done(b)
+
+	filtered = filterUnguarded(d, deleteChanges(a))
+	require.Len(t, filtered.Delete, 1, "the refused deletion is executed, once the guard approves it")
+	assert.Equal(t, "a.de", filtered.Delete[0].DNSName)
+}
+
+func TestDeferredDeletionsFailed(t *testing.T) {
+	d, clock := newTestDeferredDeletions(t, "")
+	ep := endpoint.NewEndpoint("a.de", "A", "1.1.1.1")
+
+	filterUnguarded(d, deleteChanges(ep))
+	clock.now = clock.now.Add(5 * time.Minute)
+	require.Len(t, filterUnguarded(d, deleteChanges(ep)).Delete, 1)
+
+	// the deletion failed, so Done is not called and it is retried with the next plan
+	require.Len(t, filterUnguarded(d, deleteChanges(ep)).Delete, 1)
+	d.Done(ep)
+	assert.Empty(t, d.pending)
+}
+
+func TestDeferredDeletionsCancelledByPlan(t *testing.T) {
+	d, clock := newTestDeferredDeletions(t, "")
+	a := endpoint.NewEndpoint("a.de", "A", "1.1.1.1")
+	b := endpoint.NewEndpoint("b.de", "A", "2.2.2.2")
+
+	filterUnguarded(d, deleteChanges(a, b))
+
+	// a is desired again, so only b is part of the plan
+	clock.now = clock.now.Add(3 * time.Minute)
+	filterUnguarded(d, deleteChanges(b))
+
+	clock.now = clock.now.Add(3 * time.Minute)
+	filtered := filterUnguarded(d, deleteChanges(a, b))
+	require.Len(t, filtered.Delete, 1)
+	assert.Equal(t, "b.de", filtered.Delete[0].DNSName)
+	d.Done(filtered.Delete[0])
+	assert.Len(t, d.pending, 1, "deletion of a restarts its grace period")
+}
+
+func TestDeferredDeletionsStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "pending.json")
+	d, clock := newTestDeferredDeletions(t, stateFile)
+	ep := endpoint.NewEndpoint("a.de", "TXT", "\"text\"")
+	ep.SetIdentifier = "blue"
+
+	filterUnguarded(d, deleteChanges(ep))
+	content, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"dnsName": "a.de"`)
+
+	// a restarted webhook continues the grace period
+	restarted, _ := newTestDeferredDeletions(t, stateFile)
+	restarted.now = func() time.Time { return clock.now.Add(5 * time.Minute) }
+	require.Len(t, filterUnguarded(restarted, deleteChanges(ep)).Delete, 1)
+	restarted.Done(ep)
+
+	restarted, _ = newTestDeferredDeletions(t, stateFile)
+	assert.Empty(t, restarted.pending)
+}
+
+func TestDeferredDeletionsInvalidStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "pending.json")
+	require.NoError(t, os.WriteFile(stateFile, []byte("{invalid"), 0o600))
+	d, _ := newTestDeferredDeletions(t, stateFile)
+	assert.Empty(t, d.pending)
+}
+
+func TestDeferredDeletionsMetricPerAccount(t *testing.T) {
+	a := NewDeferredDeletions(time.Hour, "", "a")
+	b := NewDeferredDeletions(time.Hour, "", "b")
+	filterUnguarded(a, deleteChanges(endpoint.NewEndpoint("a.de", "A", "1.1.1.1"), endpoint.NewEndpoint("b.a.de", "A", "1.1.1.1")))
+	filterUnguarded(b, deleteChanges(endpoint.NewEndpoint("b.de", "A", "1.1.1.1")))
+
+	assert.InDelta(t, 2, testutil.ToFloat64(pendingDeletions.WithLabelValues("a")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(pendingDeletions.WithLabelValues("b")), 0)
+
+	// a cancels one deletion and executes the other one after the grace period
+	a.now = func() time.Time { return time.Now().Add(time.Hour) }
+	filtered := filterUnguarded(a, deleteChanges(endpoint.NewEndpoint("a.de", "A", "1.1.1.1")))
+	require.Len(t, filtered.Delete, 1)
+	a.Done(filtered.Delete[0])
+	assert.InDelta(t, 1, testutil.ToFloat64(deferredDeletionsCancelled.WithLabelValues("a")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(deferredDeletionsExecuted.WithLabelValues("a")), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(deferredDeletionsExecuted.WithLabelValues("b")), 0)
+}
+
+type deferringProvider struct {
+	provider.BaseProvider
+	deferred *DeferredDeletions
+}
+
+func (p *deferringProvider) Records(context.Context) ([]*endpoint.Endpoint, error) { return nil, nil }
+
+func (p *deferringProvider) ApplyChanges(context.Context, *plan.Changes) error { return nil }
+
+func (p *deferringProvider) DeferredDeletions() *DeferredDeletions { return p.deferred }
+
+func TestHandOverDeletions(t *testing.T) {
+	previous, clock := newTestDeferredDeletions(t, "")
+	next, _ := newTestDeferredDeletions(t, "")
+	next.now = clock.Now
+	a := endpoint.NewEndpoint("a.de", "A", "1.1.1.1")
+	b := endpoint.NewEndpoint("b.de", "A", "2.2.2.2")
+
+	filterUnguarded(previous, deleteChanges(a, b))
+	clock.now = clock.now.Add(3 * time.Minute)
+	// the next provider planned the deletion of b itself, after it has replaced the previous one
+	filterUnguarded(next, deleteChanges(b))
+
+	HandOverDeletions(&deferringProvider{deferred: previous}, &deferringProvider{deferred: next})
+	require.Len(t, next.pending, 2)
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	filtered := filterUnguarded(next, deleteChanges(a, b))
+	assert.Len(t, filtered.Delete, 2, "the grace period continues with the next provider")
+
+	// providers without deferred deletions are ignored
+	HandOverDeletions(&deferringProvider{deferred: previous}, &deferringProvider{})
+	HandOverDeletions(&deferringProvider{}, &deferringProvider{deferred: next})
+}
@@ -0,0 +1,168 @@
+package ionos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DeletionGuardMode defines what the deletion guard refuses, if the deletions in a zone exceed the thresholds.
+type DeletionGuardMode string
+
+const (
+	// DeletionGuardModePlan refuses the whole plan.
+	DeletionGuardModePlan DeletionGuardMode = "plan"
+	// DeletionGuardModeDeletions refuses only the deletions of the affected zones, the other changes are applied.
+	DeletionGuardModeDeletions DeletionGuardMode = "deletions"
+)
+
+// UnmarshalText parses and validates the deletion guard mode.
+func (m *DeletionGuardMode) UnmarshalText(text []byte) error {
+	switch mode := DeletionGuardMode(strings.ToLower(strings.TrimSpace(string(text)))); mode {
+	case DeletionGuardModePlan, DeletionGuardModeDeletions:
+		*m = mode
+		return nil
+	default:
+		return fmt.Errorf("invalid deletion guard mode '%s', must be '%s' or '%s'", text, DeletionGuardModePlan, DeletionGuardModeDeletions)
+	}
+}
+
+// ErrMassDeletion is returned if the deletion guard refuses a plan.
+var ErrMassDeletion = errors.New("mass deletion refused by deletion guard")
+
+// DeletionGuard refuses plans which delete more records of a zone than configured. A nil DeletionGuard refuses nothing.
+type DeletionGuard struct {
+	maxCount     int
+	maxPercent   float64
+	mode         DeletionGuardMode
+	overrideFile string
+}
+
+// NewDeletionGuard returns a new DeletionGuard, it is disabled if neither a max count nor a max percentage is set.
+// If the override file exists, the guard is bypassed for the zones listed in it, one per line, or for all zones if it
+// does not list any zone.
+func NewDeletionGuard(maxCount int, maxPercent float64, mode DeletionGuardMode, overrideFile string) *DeletionGuard {
+	if maxCount <= 0 && maxPercent <= 0 {
+		return nil
+	}
+	if mode == "" {
+		mode = DeletionGuardModePlan
+	}
+	return &DeletionGuard{maxCount: maxCount, maxPercent: maxPercent, mode: mode, overrideFile: overrideFile}
+}
+
+// Check counts the records to delete per zone and compares them with the thresholds. zoneNameOf returns the name of the
+// zone of a dns name and recordCount the number of records in a zone, it is only called if a max percentage is set.
+// In plan mode an error wrapping ErrMassDeletion is returned, in deletions mode the changes are returned without the
+// deletions of the affected zones.
+func (g *DeletionGuard) Check(changes *plan.Changes, zoneNameOf func(string) string, recordCount func(string) (int, error)) (*plan.Changes, error) {
+	if g == nil || changes == nil || len(changes.Delete) == 0 {
+		return changes, nil
+	}
+	deletionsPerZone := make(map[string]int)
+	for _, ep := range changes.Delete {
+		if zoneName := zoneNameOf(ep.DNSName); zoneName != "" {
+			deletionsPerZone[zoneName] += len(ep.Targets)
+		}
+	}
+	zoneNames := make([]string, 0, len(deletionsPerZone))
+	for zoneName := range deletionsPerZone {
+		zoneNames = append(zoneNames, zoneName)
+	}
+	sort.Strings(zoneNames)
+
+	overrides := g.readOverrides()
+	refusedZones := make(map[string]bool)
+	var refusals []string
+	for _, zoneName := range zoneNames {
+		deletions := deletionsPerZone[zoneName]
+		reason, err := g.exceeds(zoneName, deletions, recordCount)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			continue
+		}
+		logger := log.WithField("zone", zoneName).WithField("deletions", deletions)
+		if overrides != nil && (len(overrides) == 0 || overrides[normalizeName(zoneName)]) {
+			logger.Warnf("deletion guard overridden by '%s': %s", g.overrideFile, reason)
+			continue
+		}
+		logger.Errorf("deletion guard refuses %s: %s", g.mode, reason)
+		deletionGuardRefusals.WithLabelValues(zoneName, string(g.mode)).Inc()
+		refusedZones[zoneName] = true
+		refusals = append(refusals, fmt.Sprintf("zone '%s': %s", zoneName, reason))
+	}
+	if len(refusals) == 0 {
+		return changes, nil
+	}
+	if g.mode == DeletionGuardModePlan {
+		return nil, fmt.Errorf("%w: %s, %s", ErrMassDeletion, strings.Join(refusals, "; "), g.overrideHint())
+	}
+	filtered := *changes
+	filtered.Delete = make([]*endpoint.Endpoint, 0, len(changes.Delete))
+	for _, ep := range changes.Delete {
+		if !refusedZones[zoneNameOf(ep.DNSName)] {
+			filtered.Delete = append(filtered.Delete, ep)
+		}
+	}
+	return &filtered, nil
+}
+
+// exceeds returns the reason why the deletions exceed the thresholds, an empty string if they do not.
+func (g *DeletionGuard) exceeds(zoneName string, deletions int, recordCount func(string) (int, error)) (string, error) {
+	if g.maxCount > 0 && deletions > g.maxCount {
+		return fmt.Sprintf("%d records to delete exceed the maximum of %d", deletions, g.maxCount), nil
+	}
+	if g.maxPercent <= 0 {
+		return "", nil
+	}
+	count, err := recordCount(zoneName)
+	if err != nil {
+		return "", fmt.Errorf("deletion guard failed to count the records of zone '%s': %w", zoneName, err)
+	}
+	if count == 0 {
+		return "", nil
+	}
+	if percent := float64(deletions) * 100 / float64(count); percent > g.maxPercent {
+		return fmt.Sprintf("%d of %d records to delete (%.1f%%) exceed the maximum of %.1f%%", deletions, count, percent, g.maxPercent), nil
+	}
+	return "", nil
+}
+
+func (g *DeletionGuard) overrideHint() string {
+	if g.overrideFile == "" {
+		return "raise the thresholds to apply it"
+	}
+	return fmt.Sprintf("create the file '%s' to override", g.overrideFile)
+}
+
+// readOverrides returns nil if there is no override file, otherwise the zones listed in it.
+func (g *DeletionGuard) readOverrides() map[string]bool {
+	if g.overrideFile == "" {
+		return nil
+	}
+	file, err := os.Open(g.overrideFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("failed to read deletion guard override file '%s': %v", g.overrideFile, err)
+		}
+		return nil
+	}
+	defer file.Close()
+	overrides := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if zoneName := normalizeName(scanner.Text()); zoneName != "" && !strings.HasPrefix(zoneName, "#") {
+			overrides[zoneName] = true
+		}
+	}
+	return overrides
+}
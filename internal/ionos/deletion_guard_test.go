@@ -0,0 +1,154 @@
+package ionos
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func guardChanges() *plan.Changes {
+	return &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.a.de", "A", "1.1.1.1")},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("a.de", "A", "1.1.1.1", "2.2.2.2"),
+			endpoint.NewEndpoint("www.a.de", "A", "3.3.3.3"),
+			endpoint.NewEndpoint("b.de", "A", "4.4.4.4"),
+		},
+	}
+}
+
+func guardZoneNameOf(dnsName string) string {
+	switch {
+	case strings.HasSuffix(dnsName, "a.de"):
+		return "a.de"
+	case strings.HasSuffix(dnsName, "b.de"):
+		return "b.de"
+	default:
+		return ""
+	}
+}
+
+func guardRecordCount(zoneName string) (int, error) {
+	return map[string]int{"a.de": 4, "b.de": 10}[zoneName], nil
+}
+
+func TestDeletionGuardDisabled(t *testing.T) {
+	guard := NewDeletionGuard(0, 0, DeletionGuardModePlan, "")
+	assert.Nil(t, guard)
+	changes := guardChanges()
+	actual, err := guard.Check(changes, guardZoneNameOf, guardRecordCount)
+	require.NoError(t, err)
+	assert.Same(t, changes, actual)
+}
+
+func TestDeletionGuardCheck(t *testing.T) {
+	testCases := []struct {
+		name            string
+		maxCount        int
+		maxPercent      float64
+		mode            DeletionGuardMode
+		expectedError   bool
+		expectedDeletes []string
+	}{
+		{
+			name:            "below max count",
+			maxCount:        3,
+			mode:            DeletionGuardModePlan,
+			expectedDeletes: []string{"a.de", "www.a.de", "b.de"},
+		},
+		{
+			name:          "max count exceeded refuses plan",
+			maxCount:      2,
+			mode:          DeletionGuardModePlan,
+			expectedError: true,
+		},
+		{
+			name:            "max count exceeded refuses deletions of zone",
+			maxCount:        2,
+			mode:            DeletionGuardModeDeletions,
+			expectedDeletes: []string{"b.de"},
+		},
+		{
+			name:            "below max percent",
+			maxPercent:      75,
+			mode:            DeletionGuardModePlan,
+			expectedDeletes: []string{"a.de", "www.a.de", "b.de"},
+		},
+		{
+			name:          "max percent exceeded refuses plan",
+			maxPercent:    50,
+			mode:          DeletionGuardModePlan,
+			expectedError: true,
+		},
+		{
+			name:            "max percent exceeded refuses deletions of zone",
+			maxPercent:      50,
+			mode:            DeletionGuardModeDeletions,
+			expectedDeletes: []string{"b.de"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			guard := NewDeletionGuard(tc.maxCount, tc.maxPercent, tc.mode, "")
+			changes := guardChanges()
+			actual, err := guard.Check(changes, guardZoneNameOf, guardRecordCount)
+			if tc.expectedError {
+				require.ErrorIs(t, err, ErrMassDeletion)
+				assert.Contains(t, err.Error(), "zone 'a.de'")
+				assert.NotContains(t, err.Error(), "zone 'b.de'")
+				return
+			}
+			require.NoError(t, err)
+			actualDeletes := make([]string, 0, len(actual.Delete))
+			for _, ep := range actual.Delete {
+				actualDeletes = append(actualDeletes, ep.DNSName)
+			}
+			assert.Equal(t, tc.expectedDeletes, actualDeletes)
+			assert.Equal(t, changes.Create, actual.Create)
+		})
+	}
+}
+
+func TestDeletionGuardRecordCountError(t *testing.T) {
+	guard := NewDeletionGuard(0, 50, DeletionGuardModePlan, "")
+	_, err := guard.Check(guardChanges(), guardZoneNameOf, func(string) (int, error) {
+		return 0, errors.New("api down")
+	})
+	require.ErrorContains(t, err, "api down")
+	assert.NotErrorIs(t, err, ErrMassDeletion)
+}
+
+func TestDeletionGuardOverrideFile(t *testing.T) {
+	overrideFile := filepath.Join(t.TempDir(), "override")
+	guard := NewDeletionGuard(1, 0, DeletionGuardModePlan, overrideFile)
+
+	_, err := guard.Check(guardChanges(), guardZoneNameOf, guardRecordCount)
+	require.ErrorIs(t, err, ErrMassDeletion)
+	assert.Contains(t, err.Error(), overrideFile)
+
+	require.NoError(t, os.WriteFile(overrideFile, []byte("# approved\nb.de\n"), 0o600))
+	_, err = guard.Check(guardChanges(), guardZoneNameOf, guardRecordCount)
+	require.ErrorIs(t, err, ErrMassDeletion, "override of another zone must not bypass the guard")
+
+	require.NoError(t, os.WriteFile(overrideFile, []byte("A.de.\n"), 0o600))
+	_, err = guard.Check(guardChanges(), guardZoneNameOf, guardRecordCount)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(overrideFile, nil, 0o600))
+	_, err = guard.Check(guardChanges(), guardZoneNameOf, guardRecordCount)
+	require.NoError(t, err)
+}
+
+func TestDeletionGuardModeUnmarshalText(t *testing.T) {
+	var mode DeletionGuardMode
+	require.NoError(t, mode.UnmarshalText([]byte(" Deletions ")))
+	assert.Equal(t, DeletionGuardModeDeletions, mode)
+	require.ErrorContains(t, mode.UnmarshalText([]byte("zones")), "invalid deletion guard mode 'zones'")
+}
@@ -0,0 +1,139 @@
+package ionos
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// DomainFilter combines a list based and a regex based domain filter, a domain has to match both of them.
+// The external-dns domain filter supports only one of them at a time.
+type DomainFilter struct {
+	include      []string
+	exclude      []string
+	regexInclude *regexp.Regexp
+	regexExclude *regexp.Regexp
+	listFilter   *endpoint.DomainFilter
+	regexFilter  *endpoint.DomainFilter
+}
+
+var _ endpoint.DomainFilterInterface = (*DomainFilter)(nil)
+
+// NewDomainFilter returns a new DomainFilter, given lists of included and excluded domains and regular expressions
+// for included and excluded domains. Empty regular expressions are ignored, invalid ones result in an error.
+func NewDomainFilter(include, exclude []string, regexInclude, regexExclude string) (*DomainFilter, error) {
+	f := &DomainFilter{
+		include:    prepareDomains(include),
+		exclude:    prepareDomains(exclude),
+		listFilter: endpoint.NewDomainFilterWithExclusions(include, exclude),
+	}
+	var err error
+	if f.regexInclude, err = compileRegex(regexInclude); err != nil {
+		return nil, fmt.Errorf("invalid regular expression for domain filter '%s': %w", regexInclude, err)
+	}
+	if f.regexExclude, err = compileRegex(regexExclude); err != nil {
+		return nil, fmt.Errorf("invalid regular expression for domain exclusion '%s': %w", regexExclude, err)
+	}
+	if f.regexInclude != nil || f.regexExclude != nil {
+		f.regexFilter = endpoint.NewRegexDomainFilter(f.regexInclude, f.regexExclude)
+	}
+	return f, nil
+}
+
+// Match checks whether the domain matches the list filter and the regex filter, a nil filter matches everything.
+func (f *DomainFilter) Match(domain string) bool {
+	if f == nil {
+		return true
+	}
+	if !f.listFilter.Match(domain) {
+		return false
+	}
+	return f.regexFilter == nil || f.regexFilter.Match(domain)
+}
+
+// IsConfigured returns true if any inclusion or exclusion rules have been specified.
+func (f *DomainFilter) IsConfigured() bool {
+	return f != nil && (f.listFilter.IsConfigured() || f.regexFilter != nil)
+}
+
+// String returns a human-readable description of the filter.
+func (f *DomainFilter) String() string {
+	if !f.IsConfigured() {
+		return "no kind of domain filters"
+	}
+	parts := make([]string, 0, 4)
+	if len(f.include) > 0 {
+		parts = append(parts, fmt.Sprintf("include: '%s'", strings.Join(f.include, ",")))
+	}
+	if len(f.exclude) > 0 {
+		parts = append(parts, fmt.Sprintf("exclude: '%s'", strings.Join(f.exclude, ",")))
+	}
+	if f.regexInclude != nil {
+		parts = append(parts, fmt.Sprintf("regex include: '%s'", f.regexInclude))
+	}
+	if f.regexExclude != nil {
+		parts = append(parts, fmt.Sprintf("regex exclude: '%s'", f.regexExclude))
+	}
+	return "domain filter with " + strings.Join(parts, ", ")
+}
+
+// MarshalJSON serializes the filter in the format of the external-dns domain filter, which is used in the webhook
+// negotiation. As external-dns does not accept lists and regular expressions at the same time, a filter with both is
+// serialized as regular expressions. Then the exclusions are preserved, but if both includes are set only the regex
+// include is sent, so external-dns may plan changes for more domains than the webhook accepts.
+func (f *DomainFilter) MarshalJSON() ([]byte, error) {
+	if f == nil {
+		return (*endpoint.DomainFilter)(nil).MarshalJSON()
+	}
+	if f.regexFilter == nil {
+		return f.listFilter.MarshalJSON()
+	}
+	if !f.listFilter.IsConfigured() {
+		return f.regexFilter.MarshalJSON()
+	}
+	include := f.regexInclude
+	if include == nil && len(f.include) > 0 {
+		include = regexp.MustCompile(domainsToRegex(f.include))
+	}
+	exclude := f.regexExclude
+	if len(f.exclude) > 0 {
+		excludeExpr := domainsToRegex(f.exclude)
+		if exclude != nil {
+			excludeExpr = excludeExpr + "|" + exclude.String()
+		}
+		exclude = regexp.MustCompile(excludeExpr)
+	}
+	return endpoint.NewRegexDomainFilter(include, exclude).MarshalJSON()
+}
+
+// domainsToRegex converts a list of domains to a regular expression with the semantics of the list domain filter.
+func domainsToRegex(domains []string) string {
+	expressions := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, ".") {
+			expressions = append(expressions, "^.*"+regexp.QuoteMeta(domain)+"$")
+		} else {
+			expressions = append(expressions, `^(.*\.)?`+regexp.QuoteMeta(domain)+"$")
+		}
+	}
+	return strings.Join(expressions, "|")
+}
+
+func prepareDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if domain = strings.TrimSuffix(strings.TrimSpace(domain), "."); domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
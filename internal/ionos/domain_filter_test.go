@@ -0,0 +1,126 @@
+package ionos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainFilterMatch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		include      []string
+		exclude      []string
+		regexInclude string
+		regexExclude string
+		matching     []string
+		notMatching  []string
+	}{
+		{
+			name:     "no filter",
+			matching: []string{"a.de", "b.com"},
+		},
+		{
+			name:        "list filter",
+			include:     []string{"a.de"},
+			exclude:     []string{"x.a.de"},
+			matching:    []string{"a.de", "b.a.de"},
+			notMatching: []string{"x.a.de", "b.de"},
+		},
+		{
+			name:         "regex filter",
+			regexInclude: `^.*\.a\.de$`,
+			regexExclude: `^x\.`,
+			matching:     []string{"b.a.de"},
+			notMatching:  []string{"a.de", "x.a.de", "b.de"},
+		},
+		{
+			name:         "list and regex filter",
+			include:      []string{"a.de", "b.de"},
+			exclude:      []string{"x.a.de"},
+			regexInclude: `^www\.`,
+			regexExclude: `test`,
+			matching:     []string{"www.a.de", "www.b.de"},
+			notMatching:  []string{"a.de", "www.c.de", "www.x.a.de", "www.test.b.de"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewDomainFilter(tc.include, tc.exclude, tc.regexInclude, tc.regexExclude)
+			require.NoError(t, err)
+			for _, domain := range tc.matching {
+				assert.True(t, f.Match(domain), "domain '%s' should match", domain)
+			}
+			for _, domain := range tc.notMatching {
+				assert.False(t, f.Match(domain), "domain '%s' should not match", domain)
+			}
+		})
+	}
+}
+
+func TestDomainFilterInvalidRegex(t *testing.T) {
+	_, err := NewDomainFilter(nil, nil, "a(", "")
+	require.ErrorContains(t, err, "invalid regular expression for domain filter 'a('")
+	_, err = NewDomainFilter(nil, nil, "", "[a")
+	require.ErrorContains(t, err, "invalid regular expression for domain exclusion '[a'")
+}
+
+func TestDomainFilterString(t *testing.T) {
+	f, err := NewDomainFilter([]string{""}, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "no kind of domain filters", f.String())
+	f, err = NewDomainFilter([]string{"a.de", "b.de."}, []string{"x.a.de"}, `^www\.`, "test")
+	require.NoError(t, err)
+	assert.Equal(t, `domain filter with include: 'a.de,b.de', exclude: 'x.a.de', regex include: '^www\.', regex exclude: 'test'`, f.String())
+}
+
+func TestDomainFilterMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name         string
+		include      []string
+		exclude      []string
+		regexInclude string
+		regexExclude string
+		expectedJSON string
+	}{
+		{
+			name:         "no filter",
+			expectedJSON: `{}`,
+		},
+		{
+			name:         "list filter",
+			include:      []string{"b.de", "a.de"},
+			exclude:      []string{"x.a.de"},
+			expectedJSON: `{"include":["a.de","b.de"],"exclude":["x.a.de"]}`,
+		},
+		{
+			name:         "regex filter",
+			regexInclude: `^www\.`,
+			expectedJSON: `{"regexInclude":"^www\\."}`,
+		},
+		{
+			name:         "list include and regex exclude",
+			include:      []string{"a.de", ".b.de"},
+			regexExclude: "test",
+			expectedJSON: `{"regexInclude":"^(.*\\.)?a\\.de$|^.*\\.b\\.de$","regexExclude":"test"}`,
+		},
+		{
+			name:         "list and regex filter",
+			include:      []string{"a.de"},
+			exclude:      []string{"x.a.de"},
+			regexInclude: `^www\.`,
+			regexExclude: "test",
+			expectedJSON: `{"regexInclude":"^www\\.","regexExclude":"^(.*\\.)?x\\.a\\.de$|test"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewDomainFilter(tc.include, tc.exclude, tc.regexInclude, tc.regexExclude)
+			require.NoError(t, err)
+			actualJSON, err := f.MarshalJSON()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedJSON, string(actualJSON))
+		})
+	}
+}
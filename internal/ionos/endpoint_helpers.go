@@ -81,8 +81,20 @@ func (c *RecordCollection[R]) ForEach(visit func(*endpoint.Endpoint, R) error) e
 	return nil
 }
 
+// ForEachEndpoint calls visit once per endpoint with all of its records, also for endpoints without records.
+func (c *RecordCollection[R]) ForEachEndpoint(visit func(*endpoint.Endpoint, []R) error) error {
+	for ep, records := range c.records {
+		if err := visit(ep, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type zoneNode[Z any] struct {
-	zone     Z
+	zone Z
+	// hasZone is false for the intermediate nodes of the parent domains of a zone
+	hasZone  bool
 	parent   *zoneNode[Z]
 	children map[string]*zoneNode[Z]
 }
@@ -103,6 +115,7 @@ func (d *zoneNode[Z]) visitZoneNodesByName(name string, visitor func(*zoneNode[Z
 func (d *zoneNode[Z]) addChild(zone Z, namePart string) {
 	child := &zoneNode[Z]{
 		zone:     zone,
+		hasZone:  true,
 		parent:   d,
 		children: make(map[string]*zoneNode[Z]),
 	}
@@ -120,6 +133,12 @@ func (d *zoneNode[Z]) addZone(z Z, sub string) {
 		node := &zoneNode[Z]{parent: d, children: make(map[string]*zoneNode[Z])}
 		d.children[lastPart] = node
 	}
+	if len(parts) == 1 {
+		// the node was added as parent domain of a zone added before
+		d.children[lastPart].zone = z
+		d.children[lastPart].hasZone = true
+		return
+	}
 	d.children[lastPart].addZone(z, strings.Join(parts[:len(parts)-1], "."))
 }
 
@@ -132,7 +151,9 @@ func (t *ZoneTree[Z]) AddZone(zone Z, domainName string) {
 func (t *ZoneTree[Z]) FindZoneByDomainName(domainName string) Z {
 	var result Z
 	t.root.visitZoneNodesByName(domainName, func(node *zoneNode[Z]) {
-		result = node.zone
+		if node.hasZone {
+			result = node.zone
+		}
 	})
 	return result
 }
@@ -91,3 +91,21 @@ func TestFindZoneByName(t *testing.T) {
 	require.Nil(t, zt.FindZoneByDomainName("com"))
 	require.Nil(t, zt.FindZoneByDomainName("com.a"))
 }
+
+func TestFindZoneByNameWithSubzoneAddedFirst(t *testing.T) {
+	sub, parent := &myZone{"sub.example.com"}, &myZone{"example.com"}
+	zt := NewZoneTree[*myZone]()
+	zt.AddZone(sub, sub.name)
+	zt.AddZone(parent, parent.name)
+
+	require.EqualValues(t, parent, zt.FindZoneByDomainName("example.com"))
+	require.EqualValues(t, parent, zt.FindZoneByDomainName("www.example.com"))
+	require.EqualValues(t, sub, zt.FindZoneByDomainName("www.sub.example.com"))
+	require.Equal(t, 2, zt.GetZonesCount())
+
+	// the intermediate node of a.b.example.com does not hide the zone example.com
+	deep := &myZone{"a.b.example.com"}
+	zt.AddZone(deep, deep.name)
+	require.EqualValues(t, parent, zt.FindZoneByDomainName("c.b.example.com"))
+	require.EqualValues(t, deep, zt.FindZoneByDomainName("www.a.b.example.com"))
+}
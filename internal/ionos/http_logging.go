@@ -0,0 +1,111 @@
+package ionos
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const redactedValue = "<redacted>"
+
+// redactedHeaders carry credentials, their values are never logged.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// redactedBodyFields matches the JSON fields with credentials, e.g. the token of the IONOS auth API.
+var redactedBodyFields = regexp.MustCompile(`("(?i:token|password|apiKey|secret)"\s*:\s*)"[^"]*"`)
+
+// loggingTransport logs the requests to the IONOS APIs and their responses at debug level, the credentials are
+// redacted and the bodies are truncated after maxBodySize bytes, 0 means no limit.
+type loggingTransport struct {
+	next        http.RoundTripper
+	maxBodySize int
+}
+
+// NewLoggingTransport returns a transport, which logs the requests and responses of next with the credentials redacted.
+func NewLoggingTransport(next http.RoundTripper, maxBodySize int) http.RoundTripper {
+	return &loggingTransport{next: next, maxBodySize: maxBodySize}
+}
+
+func (t *loggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		return t.next.RoundTrip(request)
+	}
+	logger := log.WithField("method", request.Method).WithField("url", request.URL.Redacted())
+	// the request must not be modified, the clone gets the body, which has been read
+	request = request.Clone(request.Context())
+	body, err := readBody(&request.Body)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithField("headers", redactHeaders(request.Header)).WithField("body", t.formatBody(body)).Debug("IONOS API request")
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+	logger = logger.WithField("duration", time.Since(start))
+	if err != nil {
+		logger.Debugf("IONOS API request failed: %v", err)
+		return response, err
+	}
+	body, err = readBody(&response.Body)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithField("status", response.StatusCode).WithField("headers", redactHeaders(response.Header)).
+		WithField("body", t.formatBody(body)).Debug("IONOS API response")
+	return response, nil
+}
+
+// readBody reads the body and replaces it with a reader of the content, so that it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	content, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body for the debug log: %w", err)
+	}
+	*body = io.NopCloser(bytes.NewReader(content))
+	return content, nil
+}
+
+func (t *loggingTransport) formatBody(body []byte) string {
+	formatted := redactedBodyFields.ReplaceAllString(string(body), `$1"`+redactedValue+`"`)
+	if t.maxBodySize > 0 && len(formatted) > t.maxBodySize {
+		// truncate at the start of a rune, so that no invalid UTF-8 is logged
+		size := t.maxBodySize
+		for size > 0 && !utf8.RuneStart(formatted[size]) {
+			size--
+		}
+		return fmt.Sprintf("%s... (%d bytes truncated)", formatted[:size], len(formatted)-size)
+	}
+	return formatted
+}
+
+// redactHeaders returns the headers as single line, the values of the headers with credentials are redacted.
+func redactHeaders(header http.Header) string {
+	lines := make([]string, 0, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = redactedValue
+		}
+		lines = append(lines, name+": "+value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
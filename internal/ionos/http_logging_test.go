@@ -0,0 +1,90 @@
+package ionos
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		_, _ = w.Write([]byte(`{"id":"1","token": "secret-token","records":"` + strings.Repeat("x", 100) + `"}`))
+	}))
+	defer server.Close()
+	hook := logtest.NewGlobal()
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.DebugLevel)
+	client := &http.Client{Transport: NewLoggingTransport(http.DefaultTransport, 60)}
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/token", strings.NewReader(`{"username":"user","password":"secret-password"}`))
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Basic secret-basic")
+	request.Header.Set("X-API-Key", "secret-key")
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Contains(t, string(body), "secret-token", "the caller gets the unredacted response")
+	assert.Equal(t, `{"username":"user","password":"secret-password"}`, received, "the server gets the unredacted request")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "IONOS API request", entries[0].Message)
+	assert.Equal(t, "Authorization: <redacted>; X-Api-Key: <redacted>", entries[0].Data["headers"])
+	assert.Equal(t, `{"username":"user","password":"<redacted>"}`, entries[0].Data["body"])
+	assert.Equal(t, "IONOS API response", entries[1].Message)
+	assert.Equal(t, http.StatusOK, entries[1].Data["status"])
+	assert.Contains(t, entries[1].Data["headers"], "Set-Cookie: <redacted>")
+	assert.Equal(t, `{"id":"1","token": "<redacted>","records":"xxxxxxxxxxxxxxxxx... (85 bytes truncated)`, entries[1].Data["body"])
+	for _, entry := range entries {
+		line, err := entry.String()
+		require.NoError(t, err)
+		assert.NotContains(t, line, "secret-")
+	}
+
+	hook.Reset()
+	log.SetLevel(log.InfoLevel)
+	response, err = client.Get(server.URL)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Empty(t, hook.AllEntries(), "nothing is logged without debug level")
+}
+
+func TestLoggingTransportTruncatesAtRuneBoundary(t *testing.T) {
+	transport := &loggingTransport{maxBodySize: 4}
+	// ä is encoded in 2 bytes, the limit falls into the second ä
+	formatted := transport.formatBody([]byte("aääb"))
+	assert.Equal(t, "aä... (3 bytes truncated)", formatted)
+	assert.True(t, utf8.ValidString(formatted))
+}
+
+func TestNewHTTPClientWarnsWithoutDebugLevel(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer log.SetLevel(log.GetLevel())
+
+	log.SetLevel(log.InfoLevel)
+	_, err := NewHTTPClient(&Configuration{Debug: true})
+	require.NoError(t, err)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	assert.Contains(t, hook.LastEntry().Message, "LOG_LEVEL=debug")
+
+	hook.Reset()
+	log.SetLevel(log.DebugLevel)
+	_, err = NewHTTPClient(&Configuration{Debug: true})
+	require.NoError(t, err)
+	assert.Empty(t, hook.AllEntries())
+}
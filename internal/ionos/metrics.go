@@ -0,0 +1,138 @@
+package ionos
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MetricsNamespace is the namespace of all metrics of the webhook.
+const MetricsNamespace = "ionos_webhook"
+
+var deletionGuardRefusals = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "deletion_guard_refusals_total",
+	Help:      "Number of plans or deletions refused by the deletion guard, by zone and mode.",
+}, []string{"zone", "mode"})
+
+var pendingDeletions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "pending_deletions",
+	Help:      "Number of deletions waiting for the end of their grace period, by account.",
+}, []string{"account"})
+
+var deferredDeletionsExecuted = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "deferred_deletions_executed_total",
+	Help:      "Number of deferred deletions executed after their grace period, by account.",
+}, []string{"account"})
+
+var deferredDeletionsCancelled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "deferred_deletions_cancelled_total",
+	Help:      "Number of deferred deletions cancelled because the record was desired again, by account.",
+}, []string{"account"})
+
+// The backends of the IONOS DNS APIs, used as metric label.
+const (
+	BackendCore  = "core"
+	BackendCloud = "cloud"
+)
+
+var apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "api_requests_total",
+	Help:      "Number of requests to the IONOS API, by backend, operation and HTTP status.",
+}, []string{"backend", "operation", "status"})
+
+var apiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: MetricsNamespace,
+	Name:      "api_request_duration_seconds",
+	Help:      "Duration of the requests to the IONOS API, by backend, operation and HTTP status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"backend", "operation", "status"})
+
+var managedZones = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "managed_zones",
+	Help:      "Number of zones managed by the webhook, by backend and account.",
+}, []string{"backend", "account"})
+
+var managedRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "records",
+	Help:      "Number of records managed by the webhook, by backend, account, zone and record type.",
+}, []string{"backend", "account", "zone", "type"})
+
+var lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "last_success_timestamp_seconds",
+	Help:      "Unix timestamp of the last successful Records or ApplyChanges call, by backend, account and operation.",
+}, []string{"backend", "account", "operation"})
+
+var buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "build_info",
+	Help:      "Build information of the webhook, the value is always 1.",
+}, []string{"version", "gitsha"})
+
+var credentialExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricsNamespace,
+	Name:      "credential_expiry_seconds",
+	Help:      "Seconds until the API token expires, negative if it has expired, by account. Not set if the token does not expire.",
+}, []string{"account"})
+
+var apiKeyRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "api_key_rotations_total",
+	Help:      "Number of API key changes read from IONOS_API_KEY_FILE, by result.",
+}, []string{"result"})
+
+var syncTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricsNamespace,
+	Name:      "sync_timeouts_total",
+	Help:      "Number of Records and ApplyChanges calls, which exceeded IONOS_SYNC_TIMEOUT, by backend and operation.",
+}, []string{"backend", "operation"})
+
+// ObserveAPICall records a request to the IONOS API, statusCode is 0 if no response was received. Requests without
+// response are recorded with the status "timeout" if err is a timeout, otherwise with "error".
+func ObserveAPICall(backend, operation string, start time.Time, statusCode int, err error) {
+	status := "error"
+	switch {
+	case statusCode > 0:
+		status = strconv.Itoa(statusCode)
+	case IsTimeout(err):
+		status = "timeout"
+	}
+	apiRequests.WithLabelValues(backend, operation, status).Inc()
+	apiRequestDuration.WithLabelValues(backend, operation, status).Observe(time.Since(start).Seconds())
+}
+
+// SetManagedZones sets the number of zones managed by the account of the backend. The account is empty without
+// accounts file.
+func SetManagedZones(backend, account string, count int) {
+	managedZones.WithLabelValues(backend, account).Set(float64(count))
+}
+
+// SetManagedRecords replaces the record counts of the account of the backend, recordCounts maps zone names to counts
+// per record type.
+func SetManagedRecords(backend, account string, recordCounts map[string]map[string]int) {
+	managedRecords.DeletePartialMatch(prometheus.Labels{"backend": backend, "account": account})
+	for zoneName, counts := range recordCounts {
+		for recordType, count := range counts {
+			managedRecords.WithLabelValues(backend, account, zoneName, recordType).Set(float64(count))
+		}
+	}
+}
+
+// SetLastSuccess sets the timestamp of the last successful operation (records or apply_changes) of the account to now.
+func SetLastSuccess(backend, account, operation string) {
+	lastSuccess.WithLabelValues(backend, account, operation).SetToCurrentTime()
+}
+
+// SetBuildInfo publishes the version and the git sha of the build.
+func SetBuildInfo(version, gitsha string) {
+	buildInfo.WithLabelValues(version, gitsha).Set(1)
+}
@@ -0,0 +1,55 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveAPICall(t *testing.T) {
+	ObserveAPICall("test", "GetZones", time.Now(), 200, nil)
+	ObserveAPICall("test", "GetZones", time.Now(), 200, nil)
+	ObserveAPICall("test", "GetZones", time.Now(), 0, fmt.Errorf("connection refused"))
+	ObserveAPICall("test", "GetZones", time.Now(), 0, fmt.Errorf("request failed: %w", context.DeadlineExceeded))
+	assert.InDelta(t, 2, testutil.ToFloat64(apiRequests.WithLabelValues("test", "GetZones", "200")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(apiRequests.WithLabelValues("test", "GetZones", "error")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(apiRequests.WithLabelValues("test", "GetZones", "timeout")), 0)
+	assert.Equal(t, 3, testutil.CollectAndCount(apiRequestDuration.MustCurryWith(map[string]string{"backend": "test"})))
+}
+
+func TestSetManagedRecords(t *testing.T) {
+	SetManagedRecords("test", "a", map[string]map[string]int{
+		"a.de": {"A": 2, "TXT": 1},
+		"b.de": {"A": 1},
+	})
+	assert.InDelta(t, 2, testutil.ToFloat64(managedRecords.WithLabelValues("test", "a", "a.de", "A")), 0)
+
+	// zones and types without records anymore are removed
+	SetManagedRecords("test", "a", map[string]map[string]int{"a.de": {"A": 3}})
+	assert.InDelta(t, 3, testutil.ToFloat64(managedRecords.WithLabelValues("test", "a", "a.de", "A")), 0)
+	assert.Equal(t, 1, testutil.CollectAndCount(managedRecords.MustCurryWith(map[string]string{"backend": "test"})))
+
+	// the records of another account of the same backend are kept
+	SetManagedRecords("test", "b", map[string]map[string]int{"c.de": {"A": 4}})
+	SetManagedRecords("test", "a", map[string]map[string]int{"a.de": {"A": 5}})
+	assert.InDelta(t, 5, testutil.ToFloat64(managedRecords.WithLabelValues("test", "a", "a.de", "A")), 0)
+	assert.InDelta(t, 4, testutil.ToFloat64(managedRecords.WithLabelValues("test", "b", "c.de", "A")), 0)
+	assert.Equal(t, 2, testutil.CollectAndCount(managedRecords.MustCurryWith(map[string]string{"backend": "test"})))
+}
+
+func TestSetManagedZones(t *testing.T) {
+	SetManagedZones("test", "a", 2)
+	SetManagedZones("test", "b", 3)
+	assert.InDelta(t, 2, testutil.ToFloat64(managedZones.WithLabelValues("test", "a")), 0)
+	assert.InDelta(t, 3, testutil.ToFloat64(managedZones.WithLabelValues("test", "b")), 0)
+}
+
+func TestSetLastSuccess(t *testing.T) {
+	before := float64(time.Now().Unix())
+	SetLastSuccess("test", "", "records")
+	assert.GreaterOrEqual(t, testutil.ToFloat64(lastSuccess.WithLabelValues("test", "", "records")), before)
+}
@@ -0,0 +1,167 @@
+package ionos
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const recordTypeNS = "NS"
+
+// ProtectionRule describes records which must never be touched by external-dns. It is parsed from the format
+// '<name pattern>[:<record type>]', e.g. 'example.com:MX' or '*.example.com'. The name pattern supports the
+// wildcards of path.Match, a missing record type or '*' matches all record types.
+type ProtectionRule struct {
+	NamePattern string
+	RecordType  string
+}
+
+// UnmarshalText parses and validates a protection rule.
+func (r *ProtectionRule) UnmarshalText(text []byte) error {
+	namePattern, recordType, _ := strings.Cut(strings.TrimSpace(string(text)), ":")
+	namePattern = normalizeName(namePattern)
+	if namePattern == "" {
+		return fmt.Errorf("protection rule '%s' has no name pattern", text)
+	}
+	if _, err := path.Match(namePattern, ""); err != nil {
+		return fmt.Errorf("protection rule '%s' has an invalid name pattern: %w", text, err)
+	}
+	r.NamePattern = namePattern
+	r.RecordType = strings.ToUpper(strings.TrimSpace(recordType))
+	if r.RecordType == "*" {
+		r.RecordType = ""
+	}
+	return nil
+}
+
+func (r ProtectionRule) String() string {
+	if r.RecordType == "" {
+		return r.NamePattern + ":*"
+	}
+	return r.NamePattern + ":" + r.RecordType
+}
+
+func (r ProtectionRule) matches(dnsName, recordType string) bool {
+	if r.RecordType != "" && r.RecordType != recordType {
+		return false
+	}
+	matched, _ := path.Match(r.NamePattern, dnsName)
+	return matched
+}
+
+// RecordProtection decides which records are protected from changes by external-dns.
+// A nil RecordProtection protects nothing.
+type RecordProtection struct {
+	rules         []ProtectionRule
+	protectApexNS bool
+	mu            sync.Mutex
+	// refused contains the refused changes, which are logged as warning only the first time
+	refused map[string]bool
+}
+
+// NewRecordProtection returns a new RecordProtection with the given rules. If protectApexNS is set, the NS records at
+// the apex of each zone are protected in addition.
+func NewRecordProtection(rules []ProtectionRule, protectApexNS bool) *RecordProtection {
+	return &RecordProtection{rules: rules, protectApexNS: protectApexNS, refused: make(map[string]bool)}
+}
+
+// IsProtected returns true if the record with the given name and type in the given zone must not be touched.
+func (p *RecordProtection) IsProtected(dnsName, recordType, zoneName string) bool {
+	if p == nil {
+		return false
+	}
+	dnsName = normalizeName(dnsName)
+	recordType = strings.ToUpper(recordType)
+	if p.protectApexNS && recordType == recordTypeNS && dnsName == normalizeName(zoneName) {
+		return true
+	}
+	for _, rule := range p.rules {
+		if rule.matches(dnsName, recordType) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterEndpoints returns the endpoints which are not protected, zoneNameOf returns the name of the zone of a dns name.
+func (p *RecordProtection) FilterEndpoints(endpoints []*endpoint.Endpoint, zoneNameOf func(string) string) []*endpoint.Endpoint {
+	if p == nil {
+		return endpoints
+	}
+	result := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if p.IsProtected(ep.DNSName, ep.RecordType, zoneNameOf(ep.DNSName)) {
+			log.Debugf("hiding protected record %s %s", ep.DNSName, ep.RecordType)
+			continue
+		}
+		result = append(result, ep)
+	}
+	return result
+}
+
+// FilterChanges returns a copy of the changes without the changes of protected records. An update is refused if either
+// the old or the new endpoint is protected. zoneNameOf returns the name of the zone of a dns name. As protected records
+// are hidden from external-dns, it plans their creation with every sync, so a refused change is logged as warning only
+// the first time and at debug level afterwards.
+func (p *RecordProtection) FilterChanges(changes *plan.Changes, zoneNameOf func(string) string) *plan.Changes {
+	if p == nil || changes == nil {
+		return changes
+	}
+	isProtected := func(action string, ep *endpoint.Endpoint) bool {
+		if !p.IsProtected(ep.DNSName, ep.RecordType, zoneNameOf(ep.DNSName)) {
+			return false
+		}
+		logger := log.WithField("action", action)
+		if p.firstRefusal(action, ep) {
+			logger.Warnf("refusing change of protected record %s %s %v", ep.DNSName, ep.RecordType, ep.Targets)
+		} else {
+			logger.Debugf("refusing change of protected record %s %s %v", ep.DNSName, ep.RecordType, ep.Targets)
+		}
+		return true
+	}
+	filter := func(action string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+		result := make([]*endpoint.Endpoint, 0, len(endpoints))
+		for _, ep := range endpoints {
+			if !isProtected(action, ep) {
+				result = append(result, ep)
+			}
+		}
+		return result
+	}
+	filtered := &plan.Changes{
+		Create:    filter("create", changes.Create),
+		Delete:    filter("delete", changes.Delete),
+		UpdateOld: make([]*endpoint.Endpoint, 0, len(changes.UpdateOld)),
+		UpdateNew: make([]*endpoint.Endpoint, 0, len(changes.UpdateNew)),
+	}
+	for i, updateOld := range changes.UpdateOld {
+		updateNew := changes.UpdateNew[i]
+		if isProtected("update", updateOld) || isProtected("update", updateNew) {
+			continue
+		}
+		filtered.UpdateOld = append(filtered.UpdateOld, updateOld)
+		filtered.UpdateNew = append(filtered.UpdateNew, updateNew)
+	}
+	return filtered
+}
+
+// firstRefusal returns true, if the change of the endpoint is refused for the first time.
+func (p *RecordProtection) firstRefusal(action string, ep *endpoint.Endpoint) bool {
+	key := action + "/" + normalizeName(ep.DNSName) + "/" + ep.RecordType
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refused[key] {
+		return false
+	}
+	p.refused[key] = true
+	return true
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
@@ -0,0 +1,113 @@
+package ionos
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestProtectionRuleUnmarshalText(t *testing.T) {
+	testCases := []struct {
+		text          string
+		expectedRule  ProtectionRule
+		expectedError string
+	}{
+		{text: "example.com:mx", expectedRule: ProtectionRule{NamePattern: "example.com", RecordType: "MX"}},
+		{text: " *.Example.com. ", expectedRule: ProtectionRule{NamePattern: "*.example.com"}},
+		{text: "example.com:*", expectedRule: ProtectionRule{NamePattern: "example.com"}},
+		{text: ":TXT", expectedError: "protection rule ':TXT' has no name pattern"},
+		{text: "[a:TXT", expectedError: "protection rule '[a:TXT' has an invalid name pattern: syntax error in pattern"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			var rule ProtectionRule
+			err := rule.UnmarshalText([]byte(tc.text))
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedRule, rule)
+		})
+	}
+}
+
+func TestRecordProtectionIsProtected(t *testing.T) {
+	protection := NewRecordProtection([]ProtectionRule{
+		{NamePattern: "a.de", RecordType: "MX"},
+		{NamePattern: "*.legacy.a.de"},
+	}, true)
+	testCases := []struct {
+		dnsName    string
+		recordType string
+		zoneName   string
+		expected   bool
+	}{
+		{dnsName: "a.de", recordType: "NS", zoneName: "a.de", expected: true},
+		{dnsName: "a.de.", recordType: "ns", zoneName: "A.de", expected: true},
+		{dnsName: "sub.a.de", recordType: "NS", zoneName: "a.de", expected: false},
+		{dnsName: "a.de", recordType: "MX", zoneName: "a.de", expected: true},
+		{dnsName: "a.de", recordType: "A", zoneName: "a.de", expected: false},
+		{dnsName: "www.legacy.a.de", recordType: "CNAME", zoneName: "a.de", expected: true},
+		{dnsName: "legacy.a.de", recordType: "A", zoneName: "a.de", expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, protection.IsProtected(tc.dnsName, tc.recordType, tc.zoneName), "%s %s", tc.dnsName, tc.recordType)
+	}
+	assert.False(t, NewRecordProtection(nil, false).IsProtected("a.de", "NS", "a.de"))
+	var nilProtection *RecordProtection
+	assert.False(t, nilProtection.IsProtected("a.de", "NS", "a.de"))
+}
+
+func TestRecordProtectionFilter(t *testing.T) {
+	protection := NewRecordProtection([]ProtectionRule{{NamePattern: "a.de", RecordType: "MX"}}, true)
+	zoneNameOf := func(string) string { return "a.de" }
+	apexNS := endpoint.NewEndpoint("a.de", "NS", "ns1.example.com")
+	apexMX := endpoint.NewEndpoint("a.de", "MX", "10 mail.a.de")
+	newMX := endpoint.NewEndpoint("a.de", "MX", "10 mail2.a.de")
+	www := endpoint.NewEndpoint("www.a.de", "A", "1.1.1.1")
+	newWww := endpoint.NewEndpoint("www.a.de", "A", "2.2.2.2")
+
+	assert.Equal(t, []*endpoint.Endpoint{www}, protection.FilterEndpoints([]*endpoint.Endpoint{apexNS, www, apexMX}, zoneNameOf))
+
+	filtered := protection.FilterChanges(&plan.Changes{
+		Create:    []*endpoint.Endpoint{apexNS, www},
+		UpdateOld: []*endpoint.Endpoint{apexMX, www},
+		UpdateNew: []*endpoint.Endpoint{newMX, newWww},
+		Delete:    []*endpoint.Endpoint{apexNS, apexMX, www},
+	}, zoneNameOf)
+	assert.Equal(t, &plan.Changes{
+		Create:    []*endpoint.Endpoint{www},
+		UpdateOld: []*endpoint.Endpoint{www},
+		UpdateNew: []*endpoint.Endpoint{newWww},
+		Delete:    []*endpoint.Endpoint{www},
+	}, filtered)
+
+	var nilProtection *RecordProtection
+	changes := &plan.Changes{Delete: []*endpoint.Endpoint{apexNS}}
+	assert.Same(t, changes, nilProtection.FilterChanges(changes, zoneNameOf))
+}
+
+func TestRecordProtectionLogsRefusalOnce(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.DebugLevel)
+	protection := NewRecordProtection([]ProtectionRule{{NamePattern: "a.de", RecordType: "MX"}}, false)
+	zoneNameOf := func(string) string { return "a.de" }
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("a.de", "MX", "10 mail.a.de")}}
+
+	protection.FilterChanges(changes, zoneNameOf)
+	protection.FilterChanges(changes, zoneNameOf)
+	protection.FilterChanges(&plan.Changes{Delete: changes.Create}, zoneNameOf)
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, log.WarnLevel, entries[0].Level)
+	assert.Equal(t, log.DebugLevel, entries[1].Level, "the repeated refusal is logged at debug level")
+	assert.Equal(t, log.WarnLevel, entries[2].Level, "the refusal of another action is logged as warning")
+}
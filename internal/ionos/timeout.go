@@ -0,0 +1,66 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// WithTimeout returns a context, which is cancelled after the timeout. A timeout of 0 disables it.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// TimeoutError is a call to the IONOS API or a sync, which did not complete within its timeout.
+type TimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+	Err       error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.Operation, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// NewTimeoutError returns err as TimeoutError of the operation, if ctx has exceeded the deadline of its timeout while
+// the parent context has not. Otherwise err is returned unchanged, e.g. if the deadline of the parent applies.
+func NewTimeoutError(parent, ctx context.Context, operation string, timeout time.Duration, err error) error {
+	if err == nil || parent.Err() != nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &TimeoutError{Operation: operation, Timeout: timeout, Err: err}
+}
+
+// IsTimeout reports whether err is caused by an exceeded deadline or a network timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// StartSync returns the context of a Records or ApplyChanges call of the backend, which is cancelled after the
+// timeout. The returned function must be called with the result of the call, it returns a TimeoutError if the call
+// has exceeded the timeout, which is counted by the metric of the sync timeouts.
+func StartSync(ctx context.Context, backend, operation string, timeout time.Duration) (context.Context, func(error) error) {
+	syncCtx, cancel := WithTimeout(ctx, timeout)
+	return syncCtx, func(err error) error {
+		defer cancel()
+		err = NewTimeoutError(ctx, syncCtx, operation, timeout, err)
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) && timeoutErr.Operation == operation {
+			syncTimeouts.WithLabelValues(backend, operation).Inc()
+		}
+		return err
+	}
+}
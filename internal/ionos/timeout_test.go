@@ -0,0 +1,53 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTimeoutError(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+	ctx, cancel := WithTimeout(parent, time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err := fmt.Errorf("request failed: %w", ctx.Err())
+
+	timeoutErr := NewTimeoutError(parent, ctx, "GetZones", time.Millisecond, err)
+	assert.EqualError(t, timeoutErr, "GetZones timed out after 1ms: request failed: context deadline exceeded")
+	assert.True(t, IsTimeout(timeoutErr))
+	assert.Nil(t, NewTimeoutError(parent, ctx, "GetZones", time.Millisecond, nil))
+
+	cancelParent()
+	assert.Same(t, err, NewTimeoutError(parent, ctx, "GetZones", time.Millisecond, err), "the deadline of the parent applies")
+
+	assert.False(t, IsTimeout(fmt.Errorf("connection refused")))
+	unlimited, cancelUnlimited := WithTimeout(context.Background(), 0)
+	defer cancelUnlimited()
+	_, hasDeadline := unlimited.Deadline()
+	assert.False(t, hasDeadline, "a timeout of 0 is disabled")
+}
+
+func TestStartSync(t *testing.T) {
+	before := testutil.ToFloat64(syncTimeouts.WithLabelValues("test", "records"))
+
+	ctx, done := StartSync(context.Background(), "test", "records", time.Millisecond)
+	<-ctx.Done()
+	err := done(ctx.Err())
+	assert.EqualError(t, err, "records timed out after 1ms: context deadline exceeded")
+	assert.InDelta(t, before+1, testutil.ToFloat64(syncTimeouts.WithLabelValues("test", "records")), 0)
+
+	ctx, done = StartSync(context.Background(), "test", "records", time.Minute)
+	callCtx, cancel := WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	<-callCtx.Done()
+	callErr := NewTimeoutError(ctx, callCtx, "GetZones", time.Millisecond, callCtx.Err())
+	assert.Same(t, callErr, done(callErr), "the timeout of the API call is kept")
+	assert.ErrorIs(t, ctx.Err(), context.Canceled, "the context of the sync is cancelled when it is done")
+	assert.InDelta(t, before+1, testutil.ToFloat64(syncTimeouts.WithLabelValues("test", "records")), 0)
+}
@@ -0,0 +1,35 @@
+package ionos
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ionos-cloud/external-dns-ionos-webhook"
+
+// Attribute keys of the spans.
+const (
+	AttributeBackend    = attribute.Key("ionos.backend")
+	AttributeZoneID     = attribute.Key("dns.zone.id")
+	AttributeZoneName   = attribute.Key("dns.zone.name")
+	AttributeRecordID   = attribute.Key("dns.record.id")
+	AttributeRecordName = attribute.Key("dns.record.name")
+	AttributeRecordType = attribute.Key("dns.record.type")
+)
+
+// StartSpan starts a span as child of the span in the context. Without configured tracing, the span is a no-op.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// RecordSpanError marks the span as failed with the error, if any.
+func RecordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package ionos
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// NewHTTPClient returns the client for the requests to the IONOS APIs, its transport is created by NewTransport and
+// creates a span per request. With IONOS_DEBUG the requests and responses are logged with redacted credentials.
+func NewHTTPClient(configuration *Configuration) (*http.Client, error) {
+	transport, err := NewTransport(configuration)
+	if err != nil {
+		return nil, err
+	}
+	var roundTripper http.RoundTripper = transport
+	if configuration.Debug {
+		if !log.IsLevelEnabled(log.DebugLevel) {
+			log.Warn("IONOS_DEBUG is set, but the requests are only logged with LOG_LEVEL=debug")
+		}
+		roundTripper = NewLoggingTransport(transport, configuration.DebugMaxBodySize)
+	}
+	return &http.Client{Transport: otelhttp.NewTransport(roundTripper)}, nil
+}
+
+// NewTransport returns a copy of the default transport with the CA bundle, the proxy, the client certificate and the
+// connection pool limits of the configuration. Without proxy URL the proxy environment variables apply.
+func NewTransport(configuration *Configuration) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = configuration.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = configuration.MaxConnsPerHost
+	transport.IdleConnTimeout = configuration.IdleConnTimeout
+	if configuration.ProxyURL != "" {
+		proxyURL, err := url.Parse(configuration.ProxyURL)
+		if err != nil {
+			// the parse error contains the URL with its credentials
+			return nil, errors.New("invalid proxy URL, must be like http://proxy.example.com:3128")
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL '%s', must be like http://proxy.example.com:3128", proxyURL.Redacted())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if err := configureTLS(transport.TLSClientConfig, configuration); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// configureTLS adds the CA certificates, which are trusted in addition to the ones of the system, and the client
+// certificate to the TLS configuration.
+func configureTLS(tlsConfig *tls.Config, configuration *Configuration) error {
+	if configuration.CAFile != "" {
+		pem, err := os.ReadFile(configuration.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file '%s': %w", configuration.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA file '%s' contains no PEM encoded certificates", configuration.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (configuration.ClientCertFile == "") != (configuration.ClientKeyFile == "") {
+		return fmt.Errorf("IONOS_CLIENT_CERT_FILE and IONOS_CLIENT_KEY_FILE must be set together")
+	}
+	if configuration.ClientCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(configuration.ClientCertFile, configuration.ClientKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate '%s': %w", configuration.ClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package ionos
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// timeout for reading the zones of the account while refreshing a ZoneDomainFilter
+const zoneDiscoveryTimeout = 30 * time.Second
+
+// matchNothing is used as include expression, if the configured filter and the discovered zones have nothing in common.
+var matchNothing = regexp.MustCompile("^$")
+
+// ZoneDomainFilter restricts the configured domain filter to the zones discovered in the account, so that external-dns
+// only plans changes for domains the webhook is able to serve. Until the zones are discovered for the first time,
+// it behaves like the configured filter.
+type ZoneDomainFilter struct {
+	configured        *DomainFilter
+	additionalDomains []string
+	mu                sync.RWMutex
+	zones             []string
+	zonesFilter       *endpoint.DomainFilter
+}
+
+var _ endpoint.DomainFilterInterface = (*ZoneDomainFilter)(nil)
+
+// NewZoneDomainFilter returns a new ZoneDomainFilter for the configured filter. The additional domains are handled like
+// discovered zones, e.g. the domains of zones that are created on demand. A configured filter with a regular expression
+// as include is serialized with it, as regular expressions cannot be intersected, so only Match is restricted to the
+// discovered zones.
+func NewZoneDomainFilter(configured endpoint.DomainFilterInterface, additionalDomains []string) *ZoneDomainFilter {
+	f := &ZoneDomainFilter{
+		configured:        toDomainFilter(configured),
+		additionalDomains: prepareDomains(additionalDomains),
+	}
+	if f.configured.regexInclude != nil {
+		log.Warnf("the domain filter returned to external-dns is not restricted to the discovered zones, because it "+
+			"includes the regular expression '%s', domains outside of the zones are still ignored", f.configured.regexInclude)
+	}
+	return f
+}
+
+// SetZones sets the names of the discovered zones.
+func (f *ZoneDomainFilter) SetZones(zoneNames []string) {
+	zones := append(prepareDomains(zoneNames), f.additionalDomains...)
+	sort.Strings(zones)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones = zones
+	f.zonesFilter = endpoint.NewDomainFilter(zones)
+	if len(zones) == 0 {
+		f.zonesFilter = endpoint.NewRegexDomainFilter(matchNothing, nil)
+	}
+}
+
+// Refresh reads the zone names with the given function and restricts the filter to them.
+func (f *ZoneDomainFilter) Refresh(ctx context.Context, readZoneNames func(context.Context) ([]string, error)) error {
+	zoneNames, err := readZoneNames(ctx)
+	if err != nil {
+		return err
+	}
+	f.SetZones(zoneNames)
+	log.Debugf("refreshed domain filter from %d discovered zones: %s", len(zoneNames), f)
+	return nil
+}
+
+// StartRefresh refreshes the filter once before it returns, so that external-dns negotiates the filter restricted to
+// the discovered zones, and then periodically in the background until the context is done. Failed refreshes are
+// logged, the filter keeps the last discovered zones or the configured filter.
+func (f *ZoneDomainFilter) StartRefresh(ctx context.Context, interval time.Duration, readZoneNames func(context.Context) ([]string, error)) {
+	refresh := func() {
+		refreshCtx, cancel := context.WithTimeout(ctx, zoneDiscoveryTimeout)
+		defer cancel()
+		if err := f.Refresh(refreshCtx, readZoneNames); err != nil {
+			log.Warnf("failed to discover zones for domain filter: %v", err)
+		}
+	}
+	refresh()
+	log.Infof("Using %s", f)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+}
+
+// Match checks whether the domain matches the configured filter and belongs to one of the discovered zones.
+func (f *ZoneDomainFilter) Match(domain string) bool {
+	if f == nil {
+		return true
+	}
+	if !f.configured.Match(domain) {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.zonesFilter == nil || f.zonesFilter.Match(domain)
+}
+
+// MarshalJSON serializes the configured filter with its includes restricted to the discovered zones.
+func (f *ZoneDomainFilter) MarshalJSON() ([]byte, error) {
+	return f.effective().MarshalJSON()
+}
+
+func (f *ZoneDomainFilter) String() string {
+	return "discovered zones " + f.effective().String()
+}
+
+// effective returns the configured filter restricted to the discovered zones.
+func (f *ZoneDomainFilter) effective() *DomainFilter {
+	if f == nil {
+		return nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.zonesFilter == nil {
+		return f.configured
+	}
+	return f.configured.restrictTo(f.zones)
+}
+
+// restrictTo returns a copy of the filter, whose includes are restricted to the given domains.
+func (f *DomainFilter) restrictTo(domains []string) *DomainFilter {
+	restricted := *f
+	restricted.include = intersectDomains(f.include, domains)
+	restricted.listFilter = endpoint.NewDomainFilterWithExclusions(restricted.include, f.exclude)
+	if len(restricted.include) == 0 {
+		restricted.regexInclude = matchNothing
+		restricted.regexFilter = endpoint.NewRegexDomainFilter(restricted.regexInclude, restricted.regexExclude)
+	}
+	return &restricted
+}
+
+// intersectDomains returns the domains covered by both lists, a domain is covered by itself and its parent domains.
+// An empty filter list covers all domains.
+func intersectDomains(filters, domains []string) []string {
+	set := make(map[string]bool)
+	for _, domain := range domains {
+		if len(filters) == 0 {
+			set[domain] = true
+		}
+		for _, filter := range filters {
+			domainName, filterName := strings.TrimPrefix(domain, "."), strings.TrimPrefix(filter, ".")
+			switch {
+			case domainName == filterName && strings.HasPrefix(domain, "."):
+				set[domain] = true
+			case domainName == filterName, isSubdomain(filterName, domainName):
+				set[filter] = true
+			case isSubdomain(domainName, filterName):
+				set[domain] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for domain := range set {
+		result = append(result, domain)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func isSubdomain(name, parent string) bool {
+	return strings.HasSuffix(name, "."+parent)
+}
+
+// toDomainFilter converts any serializable domain filter to a DomainFilter.
+func toDomainFilter(filter endpoint.DomainFilterInterface) *DomainFilter {
+	if df, ok := filter.(*DomainFilter); ok && df != nil {
+		return df
+	}
+	empty, _ := NewDomainFilter(nil, nil, "", "")
+	if filter == nil {
+		return empty
+	}
+	serialized, err := json.Marshal(filter)
+	if err != nil {
+		log.Warnf("failed to serialize domain filter, using no domain filter: %v", err)
+		return empty
+	}
+	var serde struct {
+		Include      []string `json:"include,omitempty"`
+		Exclude      []string `json:"exclude,omitempty"`
+		RegexInclude string   `json:"regexInclude,omitempty"`
+		RegexExclude string   `json:"regexExclude,omitempty"`
+	}
+	if err := json.Unmarshal(serialized, &serde); err != nil {
+		log.Warnf("failed to deserialize domain filter, using no domain filter: %v", err)
+		return empty
+	}
+	df, err := NewDomainFilter(serde.Include, serde.Exclude, serde.RegexInclude, serde.RegexExclude)
+	if err != nil {
+		log.Warnf("failed to convert domain filter, using no domain filter: %v", err)
+		return empty
+	}
+	return df
+}
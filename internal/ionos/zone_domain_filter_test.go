@@ -0,0 +1,154 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestZoneDomainFilter(t *testing.T) {
+	testCases := []struct {
+		name              string
+		configured        endpoint.DomainFilterInterface
+		additionalDomains []string
+		zones             []string
+		expectedJSON      string
+		matching          []string
+		notMatching       []string
+	}{
+		{
+			name:         "zones not discovered yet",
+			configured:   endpoint.NewDomainFilter([]string{"a.de"}),
+			zones:        nil,
+			expectedJSON: `{"include":["a.de"]}`,
+			matching:     []string{"a.de", "www.a.de"},
+			notMatching:  []string{"b.de"},
+		},
+		{
+			name:         "no configured filter",
+			configured:   &endpoint.DomainFilter{},
+			zones:        []string{"b.de", "a.de"},
+			expectedJSON: `{"include":["a.de","b.de"]}`,
+			matching:     []string{"a.de", "www.b.de"},
+			notMatching:  []string{"c.de"},
+		},
+		{
+			name:         "nil configured filter",
+			configured:   nil,
+			zones:        []string{"a.de"},
+			expectedJSON: `{"include":["a.de"]}`,
+			matching:     []string{"www.a.de"},
+			notMatching:  []string{"c.de"},
+		},
+		{
+			name:         "configured filter intersected with zones",
+			configured:   endpoint.NewDomainFilterWithExclusions([]string{"www.a.de", "b.de", "c.de"}, []string{"x.sub.b.de"}),
+			zones:        []string{"a.de", "sub.b.de", "d.de"},
+			expectedJSON: `{"include":["sub.b.de","www.a.de"],"exclude":["x.sub.b.de"]}`,
+			matching:     []string{"www.a.de", "www.sub.b.de"},
+			notMatching:  []string{"a.de", "c.de", "d.de", "x.sub.b.de"},
+		},
+		{
+			name:              "additional domains",
+			configured:        endpoint.NewDomainFilter([]string{"de"}),
+			additionalDomains: []string{".customers.de"},
+			zones:             []string{"a.de"},
+			expectedJSON:      `{"include":[".customers.de","a.de"]}`,
+			matching:          []string{"www.a.de", "acme.customers.de"},
+			notMatching:       []string{"customers.de", "b.de"},
+		},
+		{
+			name:         "nothing in common",
+			configured:   endpoint.NewDomainFilter([]string{"a.de"}),
+			zones:        []string{"b.de"},
+			expectedJSON: `{"regexInclude":"^$"}`,
+			notMatching:  []string{"a.de", "b.de"},
+		},
+		{
+			name:         "no zones",
+			configured:   &endpoint.DomainFilter{},
+			zones:        []string{},
+			expectedJSON: `{"regexInclude":"^$"}`,
+			notMatching:  []string{"a.de"},
+		},
+		{
+			name:         "regex filter",
+			configured:   endpoint.NewRegexDomainFilter(nil, regexp.MustCompile(`^x\.`)),
+			zones:        []string{"a.de"},
+			expectedJSON: `{"regexInclude":"^(.*\\.)?a\\.de$","regexExclude":"^x\\."}`,
+			matching:     []string{"www.a.de"},
+			notMatching:  []string{"x.a.de", "b.de"},
+		},
+		{
+			// regular expressions cannot be intersected, only Match is restricted to the zones
+			name:         "regex include",
+			configured:   endpoint.NewRegexDomainFilter(regexp.MustCompile(`^www\.`), nil),
+			zones:        []string{"a.de"},
+			expectedJSON: `{"regexInclude":"^www\\."}`,
+			matching:     []string{"www.a.de"},
+			notMatching:  []string{"www.b.de", "a.de"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewZoneDomainFilter(tc.configured, tc.additionalDomains)
+			if tc.zones != nil {
+				f.SetZones(tc.zones)
+			}
+			actualJSON, err := f.MarshalJSON()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedJSON, string(actualJSON))
+			for _, domain := range tc.matching {
+				assert.True(t, f.Match(domain), "domain '%s' should match", domain)
+			}
+			for _, domain := range tc.notMatching {
+				assert.False(t, f.Match(domain), "domain '%s' should not match", domain)
+			}
+		})
+	}
+}
+
+func TestZoneDomainFilterRefresh(t *testing.T) {
+	configured, err := NewDomainFilter([]string{"a.de", "b.de"}, nil, "", "")
+	require.NoError(t, err)
+	f := NewZoneDomainFilter(configured, nil)
+	calls := make(chan struct{}, 10)
+	zones := []string{"a.de"}
+	readZoneNames := func(context.Context) ([]string, error) {
+		calls <- struct{}{}
+		if len(calls) > 1 {
+			return nil, fmt.Errorf("test error")
+		}
+		return zones, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.StartRefresh(ctx, time.Millisecond, readZoneNames)
+	// the zones are discovered before StartRefresh returns
+	assert.False(t, f.Match("b.de"))
+	assert.True(t, f.Match("a.de"))
+	require.Eventually(t, func() bool { return len(calls) > 1 }, time.Second, time.Millisecond)
+	// failed refresh keeps the zones
+	assert.True(t, f.Match("a.de"))
+	assert.False(t, f.Match("b.de"))
+}
+
+func TestZoneDomainFilterFirstRefreshFails(t *testing.T) {
+	configured, err := NewDomainFilter([]string{"a.de", "b.de"}, nil, "", "")
+	require.NoError(t, err)
+	f := NewZoneDomainFilter(configured, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.StartRefresh(ctx, time.Hour, func(context.Context) ([]string, error) {
+		return nil, fmt.Errorf("test error")
+	})
+	// the configured filter applies until the zones are discovered
+	assert.True(t, f.Match("a.de"))
+	assert.True(t, f.Match("b.de"))
+}
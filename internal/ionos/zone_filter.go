@@ -0,0 +1,73 @@
+package ionos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ZoneFilter selects the zones managed by the webhook by zone id and zone name.
+// It is applied to zones in addition to the domain filter, which is also applied to the record names.
+type ZoneFilter struct {
+	zoneIDs    map[string]bool
+	nameFilter *endpoint.DomainFilter
+}
+
+// NewZoneFilter returns a new ZoneFilter, given a list of zone ids and lists of included and excluded zone names.
+// Zone names are matched in the same way as the domain filter does, e.g. 'example.com' matches also 'a.example.com'.
+func NewZoneFilter(zoneIDs, zoneNames, excludeZoneNames []string) *ZoneFilter {
+	ids := make(map[string]bool)
+	for _, id := range zoneIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return &ZoneFilter{
+		zoneIDs:    ids,
+		nameFilter: endpoint.NewDomainFilterWithExclusions(zoneNames, excludeZoneNames),
+	}
+}
+
+// Match checks whether the zone with the given id and name is selected by the filter, a nil filter matches all zones.
+func (f *ZoneFilter) Match(zoneID, zoneName string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.zoneIDs) > 0 && !f.zoneIDs[zoneID] {
+		return false
+	}
+	return f.nameFilter.Match(zoneName)
+}
+
+// MatchName checks whether the zone name is selected by the filter without considering zone ids.
+func (f *ZoneFilter) MatchName(zoneName string) bool {
+	if f == nil {
+		return true
+	}
+	return f.nameFilter.Match(zoneName)
+}
+
+// HasZoneIDs returns true if zone ids have been specified, zones created by the webhook cannot match them.
+func (f *ZoneFilter) HasZoneIDs() bool {
+	return f != nil && len(f.zoneIDs) > 0
+}
+
+// IsConfigured returns true if any zone ids or zone name rules have been specified.
+func (f *ZoneFilter) IsConfigured() bool {
+	return f != nil && (len(f.zoneIDs) > 0 || f.nameFilter.IsConfigured())
+}
+
+func (f *ZoneFilter) String() string {
+	if !f.IsConfigured() {
+		return "no zone filter"
+	}
+	ids := make([]string, 0, len(f.zoneIDs))
+	for id := range f.zoneIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	names, _ := f.nameFilter.MarshalJSON()
+	return fmt.Sprintf("zone ids: [%s], zone names: %s", strings.Join(ids, ","), names)
+}
@@ -0,0 +1,93 @@
+package ionos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneFilter(t *testing.T) {
+	testCases := []struct {
+		name               string
+		zoneFilter         *ZoneFilter
+		zoneID             string
+		zoneName           string
+		expectedMatch      bool
+		expectedConfigured bool
+	}{
+		{
+			name:               "nil filter matches everything",
+			zoneFilter:         nil,
+			zoneID:             "id1",
+			zoneName:           "a.de",
+			expectedMatch:      true,
+			expectedConfigured: false,
+		},
+		{
+			name:               "empty filter matches everything",
+			zoneFilter:         NewZoneFilter([]string{""}, []string{""}, nil),
+			zoneID:             "id1",
+			zoneName:           "a.de",
+			expectedMatch:      true,
+			expectedConfigured: false,
+		},
+		{
+			name:               "zone id matches",
+			zoneFilter:         NewZoneFilter([]string{"id1", " id2"}, nil, nil),
+			zoneID:             "id2",
+			zoneName:           "a.de",
+			expectedMatch:      true,
+			expectedConfigured: true,
+		},
+		{
+			name:               "zone id does not match",
+			zoneFilter:         NewZoneFilter([]string{"id1"}, nil, nil),
+			zoneID:             "id2",
+			zoneName:           "a.de",
+			expectedMatch:      false,
+			expectedConfigured: true,
+		},
+		{
+			name:               "zone name matches",
+			zoneFilter:         NewZoneFilter(nil, []string{"a.de"}, nil),
+			zoneID:             "id1",
+			zoneName:           "sub.a.de",
+			expectedMatch:      true,
+			expectedConfigured: true,
+		},
+		{
+			name:               "zone name excluded",
+			zoneFilter:         NewZoneFilter(nil, []string{"a.de"}, []string{"sub.a.de"}),
+			zoneID:             "id1",
+			zoneName:           "sub.a.de",
+			expectedMatch:      false,
+			expectedConfigured: true,
+		},
+		{
+			name:               "zone id matches but zone name not",
+			zoneFilter:         NewZoneFilter([]string{"id1"}, []string{"b.de"}, nil),
+			zoneID:             "id1",
+			zoneName:           "a.de",
+			expectedMatch:      false,
+			expectedConfigured: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedMatch, tc.zoneFilter.Match(tc.zoneID, tc.zoneName))
+			assert.Equal(t, tc.expectedConfigured, tc.zoneFilter.IsConfigured())
+		})
+	}
+}
+
+func TestZoneFilterString(t *testing.T) {
+	assert.Equal(t, "no zone filter", NewZoneFilter(nil, nil, nil).String())
+	assert.Equal(t, `zone ids: [id1,id2], zone names: {"include":["a.de"],"exclude":["b.a.de"]}`,
+		NewZoneFilter([]string{"id2", "id1"}, []string{"a.de"}, []string{"b.a.de"}).String())
+}
+
+func TestZoneFilterHasZoneIDs(t *testing.T) {
+	assert.False(t, (*ZoneFilter)(nil).HasZoneIDs())
+	assert.False(t, NewZoneFilter([]string{""}, []string{"a.de"}, nil).HasZoneIDs())
+	assert.True(t, NewZoneFilter([]string{"id1"}, nil, nil).HasZoneIDs())
+}
@@ -0,0 +1,69 @@
+package ionos
+
+import "strings"
+
+// MatchZonePattern returns the zone name that the given dns name belongs to according to the given zone name patterns.
+// A pattern is a zone name in which the label '*' matches exactly one arbitrary label, e.g. '*.customers.example.com'
+// matches the zone 'acme.customers.example.com' for the dns name 'www.acme.customers.example.com'.
+// If several patterns match, the longest resulting zone name is returned. If no pattern matches, an empty string is returned.
+func MatchZonePattern(patterns []string, dnsName string) string {
+	nameLabels := SplitLabels(dnsName)
+	result := ""
+	for _, pattern := range patterns {
+		patternLabels := SplitLabels(pattern)
+		if len(patternLabels) == 0 || len(patternLabels) > len(nameLabels) {
+			continue
+		}
+		suffix := nameLabels[len(nameLabels)-len(patternLabels):]
+		if !labelsMatch(patternLabels, suffix) {
+			continue
+		}
+		zoneName := strings.Join(suffix, ".")
+		if len(zoneName) > len(result) {
+			result = zoneName
+		}
+	}
+	return result
+}
+
+func labelsMatch(patternLabels, nameLabels []string) bool {
+	for i, patternLabel := range patternLabels {
+		if patternLabel != "*" && patternLabel != nameLabels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitLabels returns the lower case labels of a dns name or zone name pattern, nil for an empty name.
+func SplitLabels(name string) []string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
+
+// ZonePatternDomains returns the domains covered by the given zone name patterns, e.g. '.customers.example.com' for
+// the pattern '*.customers.example.com'. Patterns ending with a wildcard label are ignored.
+func ZonePatternDomains(patterns []string) []string {
+	domains := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		labels := SplitLabels(pattern)
+		lastWildcard := -1
+		for i, label := range labels {
+			if label == "*" {
+				lastWildcard = i
+			}
+		}
+		switch {
+		case len(labels) == 0 || lastWildcard == len(labels)-1:
+			continue
+		case lastWildcard < 0:
+			domains = append(domains, strings.Join(labels, "."))
+		default:
+			domains = append(domains, "."+strings.Join(labels[lastWildcard+1:], "."))
+		}
+	}
+	return domains
+}
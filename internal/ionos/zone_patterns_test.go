@@ -0,0 +1,75 @@
+package ionos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchZonePattern(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		dnsName  string
+		expected string
+	}{
+		{
+			name:     "no patterns",
+			patterns: nil,
+			dnsName:  "www.example.com",
+			expected: "",
+		},
+		{
+			name:     "exact zone name",
+			patterns: []string{"example.com"},
+			dnsName:  "www.example.com",
+			expected: "example.com",
+		},
+		{
+			name:     "wildcard label",
+			patterns: []string{"*.customers.example.com"},
+			dnsName:  "www.acme.customers.example.com",
+			expected: "acme.customers.example.com",
+		},
+		{
+			name:     "wildcard matches apex of zone",
+			patterns: []string{"*.customers.example.com"},
+			dnsName:  "acme.customers.example.com.",
+			expected: "acme.customers.example.com",
+		},
+		{
+			name:     "wildcard needs a label",
+			patterns: []string{"*.customers.example.com"},
+			dnsName:  "customers.example.com",
+			expected: "",
+		},
+		{
+			name:     "no match",
+			patterns: []string{"*.customers.example.com", "example.org"},
+			dnsName:  "www.example.com",
+			expected: "",
+		},
+		{
+			name:     "longest match wins",
+			patterns: []string{"example.com", "*.example.com"},
+			dnsName:  "www.acme.example.com",
+			expected: "acme.example.com",
+		},
+		{
+			name:     "case insensitive",
+			patterns: []string{"*.Example.COM"},
+			dnsName:  "WWW.acme.example.com",
+			expected: "acme.example.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, MatchZonePattern(tc.patterns, tc.dnsName))
+		})
+	}
+}
+
+func TestZonePatternDomains(t *testing.T) {
+	domains := ZonePatternDomains([]string{"*.customers.example.com", "example.org.", "a.*.example.net", "example.*", "*", ""})
+	assert.Equal(t, []string{".customers.example.com", "example.org", ".example.net"}, domains)
+}
@@ -2,14 +2,18 @@ package ionoscloud
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 	sdk "github.com/ionos-cloud/sdk-go-dns"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
@@ -17,6 +21,7 @@ import (
 
 const (
 	logFieldZoneID        = "zoneID"
+	logFieldZoneName      = "zoneName"
 	logFieldRecordID      = "recordID"
 	logFieldRecordName    = "recordName"
 	logFieldRecordFQDN    = "recordFQDN"
@@ -24,6 +29,7 @@ const (
 	logFieldRecordContent = "recordContent"
 	logFieldRecordTTL     = "recordTTL"
 	logFieldDomainFilter  = "domainFilter"
+	logFieldZoneFilter    = "zoneFilter"
 	// max number of records to read per request
 	recordReadLimit = 1000
 	// max number of records to read in total
@@ -32,29 +38,70 @@ const (
 	zoneReadLimit = 1000
 	// max number of zones to read in total
 	zoneReadMaxCount = 10 * zoneReadLimit
+	// interval of updating the credential expiry metric
+	credentialExpiryInterval = time.Minute
 
 	recordTypeSRV = "SRV"
 	recordTypeMX  = "MX"
 	recordTypeURI = "URI"
+
+	auditBackend = "ionos-cloud"
 )
 
 type DNSClient struct {
-	client *sdk.APIClient
+	// replaced when the API key is rotated, requests in flight complete with the previous client
+	client atomic.Pointer[sdk.APIClient]
 	dryRun bool
+	// limits each API call
+	timeout time.Duration
+}
+
+func newDNSClient(client *sdk.APIClient, dryRun bool, timeout time.Duration) *DNSClient {
+	dnsClient := &DNSClient{dryRun: dryRun, timeout: timeout}
+	dnsClient.client.Store(client)
+	return dnsClient
 }
 
 type DNSService interface {
 	GetAllRecords(ctx context.Context, offset int32) (sdk.RecordReadList, error)
 	GetRecordsByZoneIdAndName(ctx context.Context, zoneId, name string) (sdk.RecordReadList, error)
 	GetZones(ctx context.Context, offset int32) (sdk.ZoneReadList, error)
+	GetZone(ctx context.Context, zoneId string) (sdk.ZoneRead, error)
+	GetZonesByName(ctx context.Context, zoneName string) (sdk.ZoneReadList, error)
+	CreateZone(ctx context.Context, zoneName string) (sdk.ZoneRead, error)
 	DeleteRecord(ctx context.Context, zoneId string, recordId string) error
-	CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) error
+	CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) (sdk.RecordRead, error)
+}
+
+// startSpan starts the span of a client method.
+func startSpan(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return ionos.StartSpan(ctx, "ionoscloud.DNSClient."+operation, append(attributes, ionos.AttributeBackend.String(ionos.BackendCloud))...)
+}
+
+// observeAPICall records the metrics and the span attributes of an API call made with callCtx, the response is nil if
+// the request failed. It returns err as ionos.APIError with the status code of the response, or as ionos.TimeoutError
+// if the call exceeded the timeout of the client.
+func (c *DNSClient) observeAPICall(ctx, callCtx context.Context, span trace.Span, operation string, start time.Time, response *sdk.APIResponse, err error) error {
+	statusCode := 0
+	if response != nil && response.Response != nil {
+		statusCode = response.StatusCode
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	ionos.RecordSpanError(span, err)
+	ionos.ObserveAPICall(ionos.BackendCloud, operation, start, statusCode, err)
+	return ionos.NewAPIError(statusCode, ionos.NewTimeoutError(ctx, callCtx, operation, c.timeout, err))
 }
 
 // GetAllRecords retrieve all records https://github.com/ionos-cloud/sdk-go-dns/blob/master/docs/api/RecordsApi.md#recordsget
 func (c *DNSClient) GetAllRecords(ctx context.Context, offset int32) (sdk.RecordReadList, error) {
+	ctx, span := startSpan(ctx, "GetAllRecords", attribute.Int("ionos.offset", int(offset)))
+	defer span.End()
 	log.Debugf("get all records with offset %d ...", offset)
-	records, _, err := c.client.RecordsApi.RecordsGet(ctx).Limit(recordReadLimit).Offset(offset).FilterState(sdk.PROVISIONINGSTATE_AVAILABLE).Execute()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	records, response, err := c.client.Load().RecordsApi.RecordsGet(callCtx).Limit(recordReadLimit).Offset(offset).FilterState(sdk.PROVISIONINGSTATE_AVAILABLE).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetAllRecords", start, response, err)
 	if err != nil {
 		log.Errorf("failed to get all records: %v", err)
 		return records, err
@@ -68,10 +115,16 @@ func (c *DNSClient) GetAllRecords(ctx context.Context, offset int32) (sdk.Record
 }
 
 func (c *DNSClient) GetRecordsByZoneIdAndName(ctx context.Context, zoneId, name string) (sdk.RecordReadList, error) {
+	ctx, span := startSpan(ctx, "GetRecordsByZoneIdAndName", ionos.AttributeZoneID.String(zoneId), ionos.AttributeRecordName.String(name))
+	defer span.End()
 	logger := log.WithField(logFieldZoneID, zoneId).WithField(logFieldRecordName, name)
 	logger.Debug("get records from zone by name ...")
-	records, _, err := c.client.RecordsApi.RecordsGet(ctx).FilterZoneId(zoneId).FilterName(name).
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	records, response, err := c.client.Load().RecordsApi.RecordsGet(callCtx).FilterZoneId(zoneId).FilterName(name).
 		FilterState(sdk.PROVISIONINGSTATE_AVAILABLE).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetRecordsByZoneIdAndName", start, response, err)
 	if err != nil {
 		logger.Errorf("failed to get records from zone by name: %v", err)
 		return records, err
@@ -86,8 +139,14 @@ func (c *DNSClient) GetRecordsByZoneIdAndName(ctx context.Context, zoneId, name
 
 // GetZones client get zones method
 func (c *DNSClient) GetZones(ctx context.Context, offset int32) (sdk.ZoneReadList, error) {
+	ctx, span := startSpan(ctx, "GetZones", attribute.Int("ionos.offset", int(offset)))
+	defer span.End()
 	log.Debug("get all zones ...")
-	zones, _, err := c.client.ZonesApi.ZonesGet(ctx).Offset(offset).Limit(zoneReadLimit).FilterState(sdk.PROVISIONINGSTATE_AVAILABLE).Execute()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zones, response, err := c.client.Load().ZonesApi.ZonesGet(callCtx).Offset(offset).Limit(zoneReadLimit).FilterState(sdk.PROVISIONINGSTATE_AVAILABLE).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetZones", start, response, err)
 	if err != nil {
 		log.Errorf("failed to get all zones: %v", err)
 		return zones, err
@@ -100,32 +159,105 @@ func (c *DNSClient) GetZones(ctx context.Context, offset int32) (sdk.ZoneReadLis
 	return zones, err
 }
 
-// CreateRecord client create record method
-func (c *DNSClient) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) error {
+// GetZone client get zone method https://github.com/ionos-cloud/sdk-go-dns/blob/master/docs/api/ZonesApi.md#zonesfindbyid
+func (c *DNSClient) GetZone(ctx context.Context, zoneId string) (sdk.ZoneRead, error) {
+	ctx, span := startSpan(ctx, "GetZone", ionos.AttributeZoneID.String(zoneId))
+	defer span.End()
+	logger := log.WithField(logFieldZoneID, zoneId)
+	logger.Debug("get zone ...")
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zone, response, err := c.client.Load().ZonesApi.ZonesFindById(callCtx, zoneId).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetZone", start, response, err)
+	if err != nil {
+		logger.Errorf("failed to get zone: %v", err)
+		return zone, err
+	}
+	return zone, nil
+}
+
+// GetZonesByName returns the zones with the given name in any provisioning state, e.g. zones, which are still being
+// provisioned. The name filter of the API also matches other zone names containing the name.
+func (c *DNSClient) GetZonesByName(ctx context.Context, zoneName string) (sdk.ZoneReadList, error) {
+	ctx, span := startSpan(ctx, "GetZonesByName", ionos.AttributeZoneName.String(zoneName))
+	defer span.End()
+	logger := log.WithField(logFieldZoneName, zoneName)
+	logger.Debug("get zones by name ...")
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zones, response, err := c.client.Load().ZonesApi.ZonesGet(callCtx).FilterZoneName(zoneName).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetZonesByName", start, response, err)
+	if err != nil {
+		logger.Errorf("failed to get zones by name: %v", err)
+		return zones, err
+	}
+	return zones, nil
+}
+
+// CreateZone client create zone method https://github.com/ionos-cloud/sdk-go-dns/blob/master/docs/api/ZonesApi.md#zonespost
+func (c *DNSClient) CreateZone(ctx context.Context, zoneName string) (sdk.ZoneRead, error) {
+	ctx, span := startSpan(ctx, "CreateZone", ionos.AttributeZoneName.String(zoneName))
+	defer span.End()
+	logger := log.WithField(logFieldZoneName, zoneName)
+	logger.Debug("creating zone ...")
+	if c.dryRun {
+		logger.Info("** DRY RUN **, zone not created")
+		return sdk.ZoneRead{}, nil
+	}
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zoneRead, response, err := c.client.Load().ZonesApi.ZonesPost(callCtx).ZoneCreate(*sdk.NewZoneCreate(*sdk.NewZone(zoneName))).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "CreateZone", start, response, err)
+	if err != nil {
+		logger.Errorf("failed to create zone: %v", err)
+		return zoneRead, err
+	}
+	logger.Infof("created zone with id: '%s'", *zoneRead.GetId())
+	return zoneRead, nil
+}
+
+// CreateRecord client create record method, in dry run mode an empty record is returned
+func (c *DNSClient) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) (sdk.RecordRead, error) {
+	ctx, span := startSpan(ctx, "CreateRecord", ionos.AttributeZoneID.String(zoneId),
+		ionos.AttributeRecordName.String(*record.GetProperties().GetName()), ionos.AttributeRecordType.String(string(*record.GetProperties().GetType())))
+	defer span.End()
 	recordProps := record.GetProperties()
 	logger := log.WithField(logFieldZoneID, zoneId).WithField(logFieldRecordName, *recordProps.GetName()).
 		WithField(logFieldRecordType, *recordProps.GetType()).WithField(logFieldRecordContent, *recordProps.GetContent()).
 		WithField(logFieldRecordTTL, *recordProps.GetTtl())
 	logger.Debugf("creating record ...")
-	if !c.dryRun {
-		recordRead, _, err := c.client.RecordsApi.ZonesRecordsPost(ctx, zoneId).RecordCreate(record).Execute()
-		if err != nil {
-			logger.Errorf("failed to create record: %v", err)
-			return err
-		}
-		logger.Debugf("created successfully record with id: '%s'", *recordRead.GetId())
-	} else {
+	if c.dryRun {
 		logger.Info("** DRY RUN **, record not created")
+		return sdk.RecordRead{}, nil
 	}
-	return nil
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	recordRead, response, err := c.client.Load().RecordsApi.ZonesRecordsPost(callCtx, zoneId).RecordCreate(record).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "CreateRecord", start, response, err)
+	if err != nil {
+		logger.Errorf("failed to create record: %v", err)
+		return recordRead, err
+	}
+	logger.Debugf("created successfully record with id: '%s'", *recordRead.GetId())
+	return recordRead, nil
 }
 
 // DeleteRecord client delete record method
 func (c *DNSClient) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
+	ctx, span := startSpan(ctx, "DeleteRecord", ionos.AttributeZoneID.String(zoneId), ionos.AttributeRecordID.String(recordId))
+	defer span.End()
 	logger := log.WithField(logFieldZoneID, zoneId).WithField(logFieldRecordID, recordId)
 	logger.Debugf("deleting record: %v ...", recordId)
 	if !c.dryRun {
-		_, _, err := c.client.RecordsApi.ZonesRecordsDelete(ctx, zoneId, recordId).Execute()
+		start := time.Now()
+		callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		_, response, err := c.client.Load().RecordsApi.ZonesRecordsDelete(callCtx, zoneId, recordId).Execute()
+		err = c.observeAPICall(ctx, callCtx, span, "DeleteRecord", start, response, err)
 		if err != nil {
 			logger.Errorf("failed to delete record: %v", err)
 			return err
@@ -144,42 +276,133 @@ type Provider struct {
 	provider.BaseProvider
 	client       DNSService
 	domainFilter endpoint.DomainFilterInterface
+	zoneFilter   *ionos.ZoneFilter
+	account      string
+	zoneCreator  zoneCreator
+	protection   *ionos.RecordProtection
+	guard        *ionos.DeletionGuard
+	deferred     *ionos.DeferredDeletions
+	audit        *ionos.AuditLog
+	expiry       *ionos.CredentialExpiry
+	// the API key in use, it is obtained with username and password or rotated by the API key file
+	apiKey atomic.Pointer[string]
+	// domain filter for external-dns, restricted to the discovered zones
+	zoneDomainFilter *ionos.ZoneDomainFilter
+	// limits each Records and ApplyChanges call
+	syncTimeout time.Duration
+	// stops the background work
+	stop context.CancelFunc
 }
 
-// NewProvider returns an instance of new provider
-func NewProvider(domainFilter endpoint.DomainFilterInterface, configuration *ionos.Configuration) *Provider {
-	client := createClient(configuration)
+// NewProvider returns an instance of new provider. If username and password are configured, it obtains the API key
+// from the IONOS auth API and refreshes it in the background. The background work runs until the provider is closed.
+func NewProvider(domainFilter endpoint.DomainFilterInterface, configuration *ionos.Configuration) (*Provider, error) {
+	httpClient, err := ionos.NewHTTPClient(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// the configuration of the caller is not changed, the obtained and rotated keys are kept by the provider
+	apiKey := configuration.APIKey
+	var tokens *tokenSource
+	if configuration.Username != "" || configuration.UsernameFile != "" {
+		tokens = newTokenSource(configuration, httpClient)
+		token, err := tokens.token(ctx)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to obtain a token from the IONOS auth API: %w", err)
+		}
+		apiKey = token
+	}
+	clientFor := func(apiKey string) *sdk.APIClient {
+		rotated := *configuration
+		rotated.APIKey = apiKey
+		return createClient(&rotated, httpClient)
+	}
+	client := newDNSClient(clientFor(apiKey), configuration.DryRun, configuration.APITimeout)
+	audit, err := ionos.NewAuditLog(configuration.AuditLog, configuration.AuditLogMaxSizeMB, configuration.AuditLogMaxBackups,
+		auditBackend, configuration.DryRun)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create audit log: %w", err)
+	}
 	prov := &Provider{
-		client:       &DNSClient{client: client, dryRun: configuration.DryRun},
+		client:       client,
 		domainFilter: domainFilter,
+		zoneFilter:   ionos.NewZoneFilter(configuration.ZoneIDFilter, configuration.ZoneNameFilter, configuration.ExcludeZoneNameFilter),
+		account:      configuration.Account,
+		protection:   ionos.NewRecordProtection(configuration.ProtectedRecords, configuration.ProtectApexNS),
+		guard: ionos.NewDeletionGuard(configuration.DeletionGuardMaxCount, configuration.DeletionGuardMaxPercent,
+			configuration.DeletionGuardMode, configuration.DeletionGuardOverrideFile),
+		deferred: ionos.NewDeferredDeletions(configuration.DeletionGracePeriod, configuration.DeletionStateFile, configuration.Account),
+		audit:    audit,
+		zoneCreator: zoneCreator{
+			patterns:     configuration.ZoneAutoCreatePatterns,
+			timeout:      configuration.ZoneAutoCreateTimeout,
+			pollInterval: zoneCreatePollInterval,
+			delegation:   configuration.ZoneAutoCreateDelegation,
+		},
+		syncTimeout: configuration.SyncTimeout,
+		stop:        cancel,
+	}
+	if configuration.ZoneDiscoveryInterval > 0 {
+		prov.zoneDomainFilter = ionos.NewZoneDomainFilter(domainFilter, ionos.ZonePatternDomains(configuration.ZoneAutoCreatePatterns))
+		prov.zoneDomainFilter.StartRefresh(ctx, configuration.ZoneDiscoveryInterval, prov.readZoneNames)
 	}
-	return prov
+	prov.apiKey.Store(&apiKey)
+	prov.expiry = ionos.NewCredentialExpiry(apiKey, configuration.CredentialExpiryWarnings, configuration.Account)
+	prov.expiry.StartMonitoring(ctx, credentialExpiryInterval)
+	use := func(sdkClient *sdk.APIClient, apiKey string) {
+		client.client.Store(sdkClient)
+		prov.apiKey.Store(&apiKey)
+		prov.expiry.SetToken(apiKey)
+		prov.expiry.Observe()
+	}
+	if configuration.APIKeyFile != "" {
+		ionos.WatchAPIKeyFile(ctx, configuration.APIKeyFile, configuration.APIKeyFileInterval, apiKey,
+			func(ctx context.Context, apiKey string) error {
+				sdkClient := clientFor(apiKey)
+				// the key must be accepted by the API, before it replaces the current one
+				if _, err := newDNSClient(sdkClient, false, configuration.APITimeout).GetZones(ctx, 0); err != nil {
+					return err
+				}
+				use(sdkClient, apiKey)
+				return nil
+			})
+	}
+	if tokens != nil {
+		tokens.startRefresh(ctx, apiKey, func(apiKey string) { use(clientFor(apiKey), apiKey) })
+	}
+	return prov, nil
 }
 
-func createClient(ionosConfig *ionos.Configuration) *sdk.APIClient {
-	jwtString := func() string {
-		split := strings.Split(ionosConfig.APIKey, ".")
-		if len(split) == 3 {
-			headerBytes, _ := base64.RawStdEncoding.DecodeString(split[0])
-			payloadBytes, _ := base64.RawStdEncoding.DecodeString(split[1])
-			return fmt.Sprintf("JWT-header: %s, JWT-payload: %s", headerBytes, payloadBytes)
-		}
-		return ""
+// Close stops the background work of the provider and closes the audit log.
+func (p *Provider) Close() {
+	if p.stop != nil {
+		p.stop()
 	}
+	if err := p.audit.Close(); err != nil {
+		log.Warnf("failed to close audit log: %v", err)
+	}
+}
+
+func createClient(ionosConfig *ionos.Configuration, httpClient *http.Client) *sdk.APIClient {
 	log.Infof(
 		"Creating ionos cloud DNS client with parameters: API Endpoint URL: '%v', Auth header: '%v', Debug: '%v'",
 		ionosConfig.APIEndpointURL,
 		ionosConfig.AuthHeader,
 		ionosConfig.Debug,
 	)
-	log.Debugf("JWT: %s", jwtString())
 
 	if ionosConfig.DryRun {
 		log.Warnf("*** Dry run is enabled, no changes will be made to ionos cloud DNS ***")
 	}
 
 	sdkConfig := sdk.NewConfiguration("", "", ionosConfig.APIKey, ionosConfig.APIEndpointURL)
-	sdkConfig.Debug = ionosConfig.Debug
+	// the requests are logged by the HTTP client with redacted credentials, the SDK would dump them unredacted
+	sdkConfig.Debug = false
+	sdkConfig.LogLevel = sdk.Off
+	sdkConfig.HTTPClient = httpClient
 	apiClient := sdk.NewAPIClient(sdkConfig)
 	return apiClient
 }
@@ -203,25 +426,88 @@ func (p *Provider) readAllRecords(ctx context.Context) ([]sdk.RecordRead, error)
 			break
 		}
 	}
-	domainFilter := p.GetDomainFilter()
+	zoneIDs, err := p.readSelectedZoneIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domainFilter := p.domainFilter
 	filteredResult := make([]sdk.RecordRead, 0)
 	for _, record := range result {
 		fqdn := *record.GetMetadata().GetFqdn()
-		if domainFilter.Match(fqdn) {
-			filteredResult = append(filteredResult, record)
+		if zoneIDs != nil {
+			if zoneID, ok := record.GetMetadata().GetZoneIdOk(); !ok || !zoneIDs[*zoneID] {
+				continue
+			}
 		}
+		if !domainFilter.Match(fqdn) {
+			continue
+		}
+		filteredResult = append(filteredResult, record)
 	}
-	logger := log.WithField(logFieldDomainFilter, domainFilter)
+	logger := log.WithField(logFieldDomainFilter, domainFilter).WithField(logFieldZoneFilter, p.zoneFilter)
 	logger.Debugf("found %d records after applying domainFilter", len(filteredResult))
 	return filteredResult, nil
 }
 
+// zoneRecordCounter returns a function counting the records per zone name, all records are read once on first use.
+func (p *Provider) zoneRecordCounter(ctx context.Context, zoneNameOf func(string) string) func(string) (int, error) {
+	var counts map[string]int
+	return func(zoneName string) (int, error) {
+		if counts == nil {
+			records, err := p.readAllRecords(ctx)
+			if err != nil {
+				return 0, err
+			}
+			counts = make(map[string]int)
+			for _, record := range records {
+				counts[zoneNameOf(*record.GetMetadata().GetFqdn())]++
+			}
+		}
+		return counts[zoneName], nil
+	}
+}
+
+// readSelectedZoneIDs returns the ids of the zones selected by the zone filter, nil if no zone filter is configured.
+func (p *Provider) readSelectedZoneIDs(ctx context.Context) (map[string]bool, error) {
+	if !p.zoneFilter.IsConfigured() {
+		return nil, nil
+	}
+	allZones, err := p.readAllZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneIDs := make(map[string]bool)
+	for _, zoneRead := range allZones {
+		if p.zoneFilter.Match(*zoneRead.GetId(), *zoneRead.GetProperties().GetZoneName()) {
+			zoneIDs[*zoneRead.GetId()] = true
+		}
+	}
+	return zoneIDs, nil
+}
+
+// Records returns the records of all zones, it fails if they are not read within the sync timeout.
 func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	syncCtx, done := ionos.StartSync(ctx, ionos.BackendCloud, "records", p.syncTimeout)
+	endpoints, err := p.records(syncCtx)
+	return endpoints, done(err)
+}
+
+func (p *Provider) records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	allRecords, err := p.readAllRecords(ctx)
 	if err != nil {
 		return nil, err
 	}
-	epCollection := ionos.NewEndpointCollection[sdk.RecordRead](allRecords,
+	// protected records are counted in the metrics, but hidden from external-dns
+	visibleRecords := make([]sdk.RecordRead, 0, len(allRecords))
+	for _, record := range allRecords {
+		fqdn, recordType := *record.GetMetadata().GetFqdn(), string(*record.GetProperties().GetType())
+		if p.protection.IsProtected(fqdn, recordType, recordZoneName(record)) {
+			log.WithField(logFieldRecordFQDN, fqdn).WithField(logFieldRecordType, recordType).Debug("hiding protected record")
+			continue
+		}
+		visibleRecords = append(visibleRecords, record)
+	}
+	epCollection := ionos.NewEndpointCollection[sdk.RecordRead](visibleRecords,
 		func(recordRead sdk.RecordRead) *endpoint.Endpoint {
 			recordProperties := *recordRead.GetProperties()
 			recordMetadata := *recordRead.GetMetadata()
@@ -238,21 +524,59 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 			recordMetadata := *recordRead.GetMetadata()
 			return *recordMetadata.GetFqdn() + "/" + string(*recordProperties.GetType()) + "/" + strconv.Itoa(int(*recordProperties.GetTtl()))
 		})
+	recordCounts := make(map[string]map[string]int)
+	for _, record := range allRecords {
+		zoneName := recordZoneName(record)
+		if recordCounts[zoneName] == nil {
+			recordCounts[zoneName] = make(map[string]int)
+		}
+		recordCounts[zoneName][string(*record.GetProperties().GetType())]++
+	}
+	ionos.SetManagedRecords(ionos.BackendCloud, p.account, recordCounts)
+	ionos.SetLastSuccess(ionos.BackendCloud, p.account, "records")
 	return epCollection.RetrieveEndPoints(), nil
 }
 
+// ApplyChanges applies the changes, the remaining changes are cancelled after the sync timeout.
 func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
-	epToCreate, epToDelete := ionos.GetCreateDeleteSetsFromChanges(changes)
+	syncCtx, done := ionos.StartSync(ctx, ionos.BackendCloud, "apply_changes", p.syncTimeout)
+	return done(p.applyChanges(syncCtx, changes))
+}
+
+func (p *Provider) applyChanges(ctx context.Context, changes *plan.Changes) error {
+	ctx = ionos.WithPlanID(ctx)
 	zt, err := p.createZoneTree(ctx)
 	if err != nil {
 		return err
 	}
+	zoneNameOf := func(dnsName string) string {
+		zone := zt.FindZoneByDomainName(dnsName)
+		if !zone.HasProperties() {
+			return ""
+		}
+		return *zone.GetProperties().GetZoneName()
+	}
+	changes = p.protection.FilterChanges(changes, zoneNameOf)
+	// the guard checks all planned deletions including the deferred ones, refused deletions stay pending
+	guarded, err := p.guard.Check(changes, zoneNameOf, p.zoneRecordCounter(ctx, zoneNameOf))
+	changes = p.deferred.Filter(changes, guarded)
+	if err != nil {
+		return err
+	}
+	p.audit.LogPlan(ctx, changes)
+	epToCreate, epToDelete := ionos.GetCreateDeleteSetsFromChanges(changes)
+	if err := p.createMissingZones(ctx, zt, epToCreate); err != nil {
+		return err
+	}
+	// endpoints, whose records could not be read, are not deleted and their deferred deletions stay pending
+	lookupFailed := make(map[*endpoint.Endpoint]bool)
 	recordsToDelete := ionos.NewRecordCollection[sdk.RecordRead](epToDelete, func(ep *endpoint.Endpoint) []sdk.RecordRead {
 		logger := log.WithField(logFieldRecordFQDN, ep.DNSName)
 		records := make([]sdk.RecordRead, 0)
 		zone := zt.FindZoneByDomainName(ep.DNSName)
 		if zone.Id == nil {
 			logger.Error("no zone found for record")
+			lookupFailed[ep] = true
 			return records
 		}
 		logger = logger.WithField(logFieldZoneID, *zone.GetId())
@@ -260,6 +584,7 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 		zoneRecordReadList, err := p.client.GetRecordsByZoneIdAndName(ctx, *zone.GetId(), recordName)
 		if err != nil {
 			logger.Errorf("failed to get records for zone, error: %v", err)
+			lookupFailed[ep] = true
 			return records
 		}
 		if !zoneRecordReadList.HasItems() {
@@ -283,14 +608,21 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 		return result
 	})
 
-	if err := recordsToDelete.ForEach(func(ep *endpoint.Endpoint, recordRead sdk.RecordRead) error {
-		domainName := *recordRead.GetMetadata().GetFqdn()
-		zone := zt.FindZoneByDomainName(domainName)
-		if !zone.HasId() {
-			return fmt.Errorf("no zone found for domain '%s'", domainName)
+	if err := recordsToDelete.ForEachEndpoint(func(ep *endpoint.Endpoint, records []sdk.RecordRead) error {
+		for _, recordRead := range records {
+			domainName := *recordRead.GetMetadata().GetFqdn()
+			zone := zt.FindZoneByDomainName(domainName)
+			if !zone.HasId() {
+				return fmt.Errorf("no zone found for domain '%s'", domainName)
+			}
+			if err := p.deleteRecord(ctx, zone, recordRead); err != nil {
+				return err
+			}
 		}
-		err := p.client.DeleteRecord(ctx, *zone.GetId(), *recordRead.GetId())
-		return err
+		if !lookupFailed[ep] {
+			p.deferred.Done(ep)
+		}
+		return nil
 	}); err != nil {
 		return err
 	}
@@ -338,16 +670,104 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 		if !zone.HasId() {
 			return fmt.Errorf("no zone found for domain '%s'", ep.DNSName)
 		}
-		err := p.client.CreateRecord(ctx, *zone.GetId(), *recordCreate)
-		return err
+		return p.createRecord(ctx, zone, *recordCreate)
 	}); err != nil {
 		return err
 	}
+	ionos.SetLastSuccess(ionos.BackendCloud, p.account, "apply_changes")
 	return nil
 }
 
+// createRecord creates the record in the zone and writes the audit entry.
+func (p *Provider) createRecord(ctx context.Context, zone sdk.ZoneRead, recordCreate sdk.RecordCreate) error {
+	recordRead, err := p.client.CreateRecord(ctx, *zone.GetId(), recordCreate)
+	entry := ionos.AuditEntry{
+		Action: ionos.AuditActionCreate,
+		Zone:   *zone.GetProperties().GetZoneName(),
+		ZoneID: *zone.GetId(),
+		After:  auditRecord(recordCreate.GetProperties(), *zone.GetProperties().GetZoneName()),
+	}
+	if recordRead.HasId() {
+		entry.RecordID = *recordRead.GetId()
+	}
+	p.audit.Log(ctx, entry, err)
+	return err
+}
+
+// deleteRecord deletes the record from the zone and writes the audit entry.
+func (p *Provider) deleteRecord(ctx context.Context, zone sdk.ZoneRead, recordRead sdk.RecordRead) error {
+	err := p.client.DeleteRecord(ctx, *zone.GetId(), *recordRead.GetId())
+	p.audit.Log(ctx, ionos.AuditEntry{
+		Action:   ionos.AuditActionDelete,
+		Zone:     *zone.GetProperties().GetZoneName(),
+		ZoneID:   *zone.GetId(),
+		RecordID: *recordRead.GetId(),
+		Before:   auditRecord(recordRead.GetProperties(), *zone.GetProperties().GetZoneName()),
+	}, err)
+	return err
+}
+
+// auditRecord converts the record properties to the audit format with the fully qualified name.
+func auditRecord(record *sdk.Record, zoneName string) *ionos.AuditRecord {
+	result := &ionos.AuditRecord{Name: zoneName}
+	if name := record.GetName(); name != nil && *name != "" {
+		result.Name = *name + "." + zoneName
+	}
+	if recordType := record.GetType(); recordType != nil {
+		result.Type = string(*recordType)
+	}
+	if content := record.GetContent(); content != nil {
+		result.Content = *content
+	}
+	if ttl := record.GetTtl(); ttl != nil {
+		result.TTL = *ttl
+	}
+	if priority := record.GetPriority(); priority != nil {
+		result.Priority = *priority
+	}
+	return result
+}
+
 func (p *Provider) createZoneTree(ctx context.Context) (*ionos.ZoneTree[sdk.ZoneRead], error) {
+	allZones, err := p.readAllZones(ctx)
+	if err != nil {
+		return nil, err
+	}
 	zt := ionos.NewZoneTree[sdk.ZoneRead]()
+	managed := 0
+	for _, zoneRead := range allZones {
+		zoneName := *zoneRead.GetProperties().GetZoneName()
+		if p.domainFilter.Match(zoneName) && p.zoneFilter.Match(*zoneRead.GetId(), zoneName) {
+			zt.AddZone(zoneRead, zoneName)
+			managed++
+		}
+	}
+	ionos.SetManagedZones(ionos.BackendCloud, p.account, managed)
+	return zt, nil
+}
+
+// readZoneNames returns the names of all zones selected by the zone filter.
+func (p *Provider) readZoneNames(ctx context.Context) ([]string, error) {
+	allZones, err := p.readAllZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneNames := make([]string, 0, len(allZones))
+	managed := 0
+	for _, zoneRead := range allZones {
+		zoneName := *zoneRead.GetProperties().GetZoneName()
+		if p.zoneFilter.Match(*zoneRead.GetId(), zoneName) {
+			zoneNames = append(zoneNames, zoneName)
+			if p.domainFilter.Match(zoneName) {
+				managed++
+			}
+		}
+	}
+	ionos.SetManagedZones(ionos.BackendCloud, p.account, managed)
+	return zoneNames, nil
+}
+
+func (p *Provider) readAllZones(ctx context.Context) ([]sdk.ZoneRead, error) {
 	var allZones []sdk.ZoneRead
 	offset := int32(0)
 	for {
@@ -366,13 +786,17 @@ func (p *Provider) createZoneTree(ctx context.Context) (*ionos.ZoneTree[sdk.Zone
 			break
 		}
 	}
-	for _, zoneRead := range allZones {
-		zoneName := *zoneRead.GetProperties().GetZoneName()
-		if p.GetDomainFilter().Match(zoneName) {
-			zt.AddZone(zoneRead, zoneName)
-		}
+	return allZones, nil
+}
+
+// recordZoneName returns the name of the zone of the record, derived from its fqdn and its name relative to the zone.
+func recordZoneName(record sdk.RecordRead) string {
+	fqdn := *record.GetMetadata().GetFqdn()
+	name := record.GetProperties().GetName()
+	if name == nil || *name == "" || *name == "@" {
+		return fqdn
 	}
-	return zt, nil
+	return strings.TrimPrefix(fqdn, *name+".")
 }
 
 func extractRecordName(fqdn string, zone sdk.ZoneRead) string {
@@ -384,6 +808,34 @@ func extractRecordName(fqdn string, zone sdk.ZoneRead) string {
 	return fqdn[:partOfZoneName-1]
 }
 
+// CheckAPI reads the zones to verify, that the API is reachable and accepts the credentials.
+func (p *Provider) CheckAPI(ctx context.Context) error {
+	_, err := p.client.GetZones(ctx, 0)
+	return err
+}
+
+// APIKey returns the API key in use, which is the token obtained with username and password, if they are configured.
+func (p *Provider) APIKey() string {
+	if apiKey := p.apiKey.Load(); apiKey != nil {
+		return *apiKey
+	}
+	return ""
+}
+
+// CheckCredentials returns an error if the API token has expired.
+func (p *Provider) CheckCredentials(ctx context.Context) error {
+	return p.expiry.Check(ctx)
+}
+
+// DeferredDeletions returns the deletions held back for their grace period.
+func (p *Provider) DeferredDeletions() *ionos.DeferredDeletions {
+	return p.deferred
+}
+
+// GetDomainFilter returns the domain filter for external-dns, which is restricted to the discovered zones if enabled.
 func (p *Provider) GetDomainFilter() endpoint.DomainFilterInterface {
+	if p.zoneDomainFilter != nil {
+		return p.zoneDomainFilter
+	}
 	return p.domainFilter
 }
@@ -2,9 +2,17 @@ package ionoscloud
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 	sdk "github.com/ionos-cloud/sdk-go-dns"
@@ -21,12 +29,21 @@ func TestNewProvider(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	t.Setenv("IONOS_API_KEY", "1")
 	domainFilter := endpoint.NewDomainFilter([]string{"a.de."})
-	p := NewProvider(domainFilter, &ionos.Configuration{})
+	p, err := NewProvider(domainFilter, &ionos.Configuration{})
+	require.NoError(t, err)
 	require.True(t, true, p.GetDomainFilter().Match("a.de."))
 	require.False(t, p.GetDomainFilter().Match("b.de."))
 
-	p = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{})
+	p, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{})
+	require.NoError(t, err)
 	require.True(t, true, p.GetDomainFilter().Match("everything.com"))
+	p.Close()
+
+	_, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{AuditLog: filepath.Join(t.TempDir(), "missing", "audit.log")})
+	require.ErrorContains(t, err, "failed to create audit log")
+
+	_, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{ProxyURL: "proxy"})
+	require.ErrorContains(t, err, "failed to create HTTP client")
 }
 
 func TestRecords(t *testing.T) {
@@ -632,6 +649,262 @@ func TestApplyChanges(t *testing.T) {
 	}
 }
 
+func TestRecordsWithZoneFilter(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	records := createRecordReadList(3, 0, 0, func(i int) (string, string, string, int32, string) {
+		zoneName := []string{"a.de", "b.de", "c.de"}[i]
+		return "www", "www." + zoneName, "A", 300, "1.1.1.1"
+	})
+	for i, zoneId := range []string{"aZoneId", "bZoneId", "cZoneId"} {
+		(*records.GetItems())[i].GetMetadata().SetZoneId(zoneId)
+	}
+	zones := createZoneReadList(3, func(i int) (string, string) {
+		return []string{"aZoneId", "bZoneId", "cZoneId"}[i], []string{"a.de", "b.de", "c.de"}[i]
+	})
+	testCases := []struct {
+		name            string
+		givenZoneFilter *ionos.ZoneFilter
+		expectedFQDNs   []string
+	}{
+		{
+			name:            "no zone filter",
+			givenZoneFilter: ionos.NewZoneFilter(nil, nil, nil),
+			expectedFQDNs:   []string{"www.a.de", "www.b.de", "www.c.de"},
+		},
+		{
+			name:            "zone id filter",
+			givenZoneFilter: ionos.NewZoneFilter([]string{"aZoneId", "cZoneId"}, nil, nil),
+			expectedFQDNs:   []string{"www.a.de", "www.c.de"},
+		},
+		{
+			name:            "zone name filter",
+			givenZoneFilter: ionos.NewZoneFilter(nil, []string{"b.de", "c.de"}, []string{"c.de"}),
+			expectedFQDNs:   []string{"www.b.de"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prov := &Provider{client: &mockDNSClient{allRecords: records, allZones: zones}, domainFilter: &endpoint.DomainFilter{}, zoneFilter: tc.givenZoneFilter}
+			endpoints, err := prov.Records(context.Background())
+			require.NoError(t, err)
+			actualFQDNs := make([]string, 0)
+			for _, ep := range endpoints {
+				actualFQDNs = append(actualFQDNs, ep.DNSName)
+			}
+			assert.ElementsMatch(t, tc.expectedFQDNs, actualFQDNs)
+
+			zt, err := prov.createZoneTree(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, len(tc.expectedFQDNs), zt.GetZonesCount())
+		})
+	}
+}
+
+func TestProtectedRecords(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	records := createRecordReadList(3, 0, 0, func(i int) (string, string, string, int32, string) {
+		switch i {
+		case 0:
+			return "", "a.de", "NS", 300, "ns1.example.com"
+		case 1:
+			return "", "a.de", "MX", 300, "mail.a.de"
+		default:
+			return "www", "www.a.de", "A", 300, "1.1.1.1"
+		}
+	})
+	mockDnsClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneReadList(1, func(int) (string, string) { return "aZoneId", "a.de" }),
+		zoneRecords: map[string]sdk.RecordReadList{"aZoneId": records},
+	}
+	prov := &Provider{
+		client:       mockDnsClient,
+		domainFilter: &endpoint.DomainFilter{},
+		protection:   ionos.NewRecordProtection([]ionos.ProtectionRule{{NamePattern: "a.de", RecordType: "MX"}}, true),
+	}
+
+	endpoints, err := prov.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	require.Equal(t, "www.a.de", endpoints[0].DNSName)
+
+	err = prov.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("a.de", "NS", "ns2.example.com")},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("a.de", "NS", "ns1.example.com"),
+			endpoint.NewEndpoint("a.de", "MX", "mail.a.de"),
+			endpoint.NewEndpoint("www.a.de", "A", "1.1.1.1"),
+		},
+	})
+	require.NoError(t, err)
+	require.Empty(t, mockDnsClient.createdRecords)
+	require.Equal(t, map[string][]string{"aZoneId": {"2"}}, mockDnsClient.deletedRecords)
+}
+
+func TestDeletionGuard(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	records := createRecordReadList(4, 0, 0, func(i int) (string, string, string, int32, string) {
+		return fmt.Sprintf("www%d", i), fmt.Sprintf("www%d.a.de", i), "A", 300, "1.1.1.1"
+	})
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.a.de", "A", "2.2.2.2")},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("www0.a.de", "A", "1.1.1.1"),
+			endpoint.NewEndpoint("www1.a.de", "A", "1.1.1.1"),
+			endpoint.NewEndpoint("www2.a.de", "A", "1.1.1.1"),
+		},
+	}
+	newProvider := func(mode ionos.DeletionGuardMode) (*Provider, *mockDNSClient) {
+		mockDnsClient := &mockDNSClient{
+			allRecords:  records,
+			allZones:    createZoneReadList(1, func(int) (string, string) { return "aZoneId", "a.de" }),
+			zoneRecords: map[string]sdk.RecordReadList{"aZoneId": records},
+		}
+		return &Provider{
+			client:       mockDnsClient,
+			domainFilter: &endpoint.DomainFilter{},
+			guard:        ionos.NewDeletionGuard(0, 50, mode, ""),
+		}, mockDnsClient
+	}
+
+	prov, mockDnsClient := newProvider(ionos.DeletionGuardModePlan)
+	err := prov.ApplyChanges(ctx, changes)
+	require.ErrorIs(t, err, ionos.ErrMassDeletion)
+	require.Empty(t, mockDnsClient.createdRecords)
+	require.Empty(t, mockDnsClient.deletedRecords)
+
+	prov, mockDnsClient = newProvider(ionos.DeletionGuardModeDeletions)
+	err = prov.ApplyChanges(ctx, changes)
+	require.NoError(t, err)
+	require.Len(t, mockDnsClient.createdRecords["aZoneId"], 1)
+	require.Empty(t, mockDnsClient.deletedRecords)
+}
+
+func TestDeferredDeletionsRefusedOrFailed(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	records := createRecordReadList(4, 0, 0, func(i int) (string, string, string, int32, string) {
+		return fmt.Sprintf("www%d", i), fmt.Sprintf("www%d.a.de", i), "A", 300, "1.1.1.1"
+	})
+	mockDnsClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneReadList(1, func(int) (string, string) { return "aZoneId", "a.de" }),
+		zoneRecords: map[string]sdk.RecordReadList{"aZoneId": records},
+	}
+	stateFile := filepath.Join(t.TempDir(), "pending.json")
+	prov := &Provider{
+		client:       mockDnsClient,
+		domainFilter: &endpoint.DomainFilter{},
+		deferred:     ionos.NewDeferredDeletions(time.Nanosecond, stateFile, ""),
+	}
+	apply := func() error {
+		_, err := prov.Records(ctx)
+		require.NoError(t, err)
+		return prov.ApplyChanges(ctx, &plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("www0.a.de", "A", "1.1.1.1")}})
+	}
+	isPending := func() bool {
+		content, err := os.ReadFile(stateFile)
+		require.NoError(t, err)
+		return strings.Contains(string(content), `"dnsName": "www0.a.de"`)
+	}
+	require.NoError(t, apply())
+	require.True(t, isPending())
+
+	// the grace period is over, but the guard refuses the deletion
+	prov.guard = ionos.NewDeletionGuard(0, 10, ionos.DeletionGuardModeDeletions, "")
+	require.NoError(t, apply())
+	require.True(t, isPending(), "the refused deletion stays pending")
+
+	// the deletion fails
+	prov.guard = nil
+	mockDnsClient.deleteError = fmt.Errorf("DeleteRecord failed")
+	require.Error(t, apply())
+	require.True(t, isPending(), "the failed deletion stays pending")
+	require.Empty(t, mockDnsClient.deletedRecords)
+
+	mockDnsClient.deleteError = nil
+	require.NoError(t, apply())
+	require.False(t, isPending(), "the deletion is done")
+	require.Equal(t, []string{"0"}, mockDnsClient.deletedRecords["aZoneId"])
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	records := createRecordReadList(1, 0, 0, func(int) (string, string, string, int32, string) {
+		return "www", "www.a.de", "A", 300, "1.1.1.1"
+	})
+	mockDnsClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneReadList(1, func(int) (string, string) { return "aZoneId", "a.de" }),
+		zoneRecords: map[string]sdk.RecordReadList{"aZoneId": records},
+	}
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := ionos.NewAuditLog(auditFile, 10, 1, auditBackend, false)
+	require.NoError(t, err)
+	prov := &Provider{client: mockDnsClient, domainFilter: &endpoint.DomainFilter{}, audit: audit}
+
+	err = prov.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "2.2.2.2")},
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 3)
+	entries := make([]ionos.AuditEntry, len(lines))
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+		require.Equal(t, entries[0].PlanID, entries[i].PlanID)
+		require.Equal(t, auditBackend, entries[i].Backend)
+	}
+	require.Equal(t, ionos.AuditActionPlan, entries[0].Action)
+	require.Equal(t, ionos.AuditActionDelete, entries[1].Action)
+	require.Equal(t, "aZoneId", entries[1].ZoneID)
+	require.Equal(t, &ionos.AuditRecord{Name: "www.a.de", Type: "A", Content: "1.1.1.1", TTL: 300}, entries[1].Before)
+	require.Equal(t, ionos.AuditActionCreate, entries[2].Action)
+	require.Equal(t, "aZoneId-1", entries[2].RecordID)
+	require.Equal(t, &ionos.AuditRecord{Name: "www.a.de", Type: "A", Content: "2.2.2.2", TTL: 300}, entries[2].After)
+	require.Equal(t, "success", entries[2].Result)
+}
+
+func TestGetDomainFilterWithZoneDiscovery(t *testing.T) {
+	zones := createZoneReadList(3, func(i int) (string, string) {
+		return fmt.Sprintf("zone%d", i), []string{"a.de", "b.de", "c.de"}[i]
+	})
+	prov := &Provider{
+		client:       &mockDNSClient{allZones: zones},
+		domainFilter: endpoint.NewDomainFilter([]string{"a.de", "b.de", "d.de"}),
+		zoneFilter:   ionos.NewZoneFilter(nil, nil, []string{"b.de"}),
+	}
+	prov.zoneDomainFilter = ionos.NewZoneDomainFilter(prov.domainFilter, nil)
+	require.NoError(t, prov.zoneDomainFilter.Refresh(context.Background(), prov.readZoneNames))
+	actualJSON, err := json.Marshal(prov.GetDomainFilter())
+	require.NoError(t, err)
+	assert.Equal(t, `{"include":["a.de"]}`, string(actualJSON))
+}
+
+func TestCheckAPI(t *testing.T) {
+	client := &mockDNSClient{allZones: createZoneReadList(1, func(int) (string, string) { return "zone0", "a.de" })}
+	prov := &Provider{client: client}
+	require.NoError(t, prov.CheckAPI(context.Background()))
+
+	client.returnError = fmt.Errorf("401 Unauthorized")
+	require.Error(t, prov.CheckAPI(context.Background()))
+}
+
+func TestCheckCredentials(t *testing.T) {
+	prov := &Provider{}
+	require.NoError(t, prov.CheckCredentials(context.Background()))
+
+	expiredToken := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1000}`)) + ".signature"
+	prov.expiry = ionos.NewCredentialExpiry(expiredToken, nil, "")
+	require.EqualError(t, prov.CheckCredentials(context.Background()), "the API token expired at "+time.Unix(1000, 0).Format(time.RFC3339))
+}
+
 func TestAdjustEndpoints(t *testing.T) {
 	prov := &Provider{}
 	endpoints := createEndpointSlice(rand.Intn(5), func(i int) (string, string, endpoint.TTL, []string) {
@@ -690,11 +963,19 @@ func (pagingMockDNSService) GetZone(ctx context.Context, zoneId string) (sdk.Zon
 	panic("implement me")
 }
 
+func (pagingMockDNSService) GetZonesByName(ctx context.Context, zoneName string) (sdk.ZoneReadList, error) {
+	panic("implement me")
+}
+
+func (pagingMockDNSService) CreateZone(ctx context.Context, zoneName string) (sdk.ZoneRead, error) {
+	panic("implement me")
+}
+
 func (pagingMockDNSService) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
 	panic("implement me")
 }
 
-func (pagingMockDNSService) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) error {
+func (pagingMockDNSService) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) (sdk.RecordRead, error) {
 	panic("implement me")
 }
 
@@ -705,6 +986,11 @@ type mockDNSClient struct {
 	allZones       sdk.ZoneReadList
 	createdRecords map[string][]sdk.RecordCreate // zoneId -> recordCreates
 	deletedRecords map[string][]string           // zoneId -> recordIds
+	createdZones   []string                      // zoneNames
+	// returned by DeleteRecord only
+	deleteError error
+	// zones, which are not available yet and therefore not returned by GetZones
+	provisioningZones []sdk.ZoneRead
 }
 
 func (c *mockDNSClient) GetAllRecords(ctx context.Context, offset int32) (sdk.RecordReadList, error) {
@@ -751,17 +1037,54 @@ func (c *mockDNSClient) GetZone(ctx context.Context, zoneId string) (sdk.ZoneRea
 	return *sdk.NewZoneReadWithDefaults(), c.returnError
 }
 
-func (c *mockDNSClient) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) error {
+func (c *mockDNSClient) GetZonesByName(ctx context.Context, zoneName string) (sdk.ZoneReadList, error) {
+	log.Debugf("GetZonesByName called with zoneName %s", zoneName)
+	var items []sdk.ZoneRead
+	if c.allZones.HasItems() {
+		items = append(items, *c.allZones.GetItems()...)
+	}
+	result := make([]sdk.ZoneRead, 0)
+	for _, zone := range append(items, c.provisioningZones...) {
+		if strings.Contains(*zone.GetProperties().GetZoneName(), zoneName) {
+			result = append(result, zone)
+		}
+	}
+	return sdk.ZoneReadList{Items: &result}, c.returnError
+}
+
+func (c *mockDNSClient) CreateZone(ctx context.Context, zoneName string) (sdk.ZoneRead, error) {
+	log.Debugf("CreateZone called with zoneName %s", zoneName)
+	c.createdZones = append(c.createdZones, zoneName)
+	if c.returnError != nil {
+		return sdk.ZoneRead{}, c.returnError
+	}
+	zone := createZoneReadList(1, func(int) (string, string) { return zoneName + "Id", zoneName })
+	zoneRead := (*zone.GetItems())[0]
+	zoneRead.SetMetadata(*sdk.NewMetadataWithStateNameservers(sdk.PROVISIONINGSTATE_AVAILABLE, []string{"ns1.example.com", "ns2.example.com"}))
+	var items []sdk.ZoneRead
+	if c.allZones.HasItems() {
+		items = *c.allZones.GetItems()
+	}
+	c.allZones.SetItems(append(items, zoneRead))
+	return zoneRead, nil
+}
+
+func (c *mockDNSClient) CreateRecord(ctx context.Context, zoneId string, record sdk.RecordCreate) (sdk.RecordRead, error) {
 	log.Debugf("CreateRecord called with zoneId %s and record %v", zoneId, record)
 	if c.createdRecords == nil {
 		c.createdRecords = make(map[string][]sdk.RecordCreate)
 	}
 	c.createdRecords[zoneId] = append(c.createdRecords[zoneId], record)
-	return c.returnError
+	recordRead := sdk.RecordRead{}
+	recordRead.SetId(fmt.Sprintf("%s-%d", zoneId, len(c.createdRecords[zoneId])))
+	return recordRead, c.returnError
 }
 
 func (c *mockDNSClient) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
 	log.Debugf("DeleteRecord called with zoneId %s and recordId %s", zoneId, recordId)
+	if c.deleteError != nil {
+		return c.deleteError
+	}
 	if c.deletedRecords == nil {
 		c.deletedRecords = make(map[string][]string)
 	}
@@ -849,3 +1172,34 @@ func createEndpointSlice(count int, modifier func(int) (string, string, endpoint
 	}
 	return endpoints
 }
+
+func TestTimeouts(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+	newProvider := func(apiTimeout, syncTimeout time.Duration) *Provider {
+		p, err := NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{
+			APIKey:         "key",
+			APIEndpointURL: api.URL,
+			AuthHeader:     "Bearer",
+			APITimeout:     apiTimeout,
+			SyncTimeout:    syncTimeout,
+		})
+		require.NoError(t, err)
+		t.Cleanup(p.Close)
+		return p
+	}
+
+	_, err := newProvider(50*time.Millisecond, time.Minute).Records(context.Background())
+	var timeoutErr *ionos.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "GetAllRecords", timeoutErr.Operation, "the call exceeds its timeout")
+
+	err = newProvider(time.Minute, 50*time.Millisecond).ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.a.de", endpoint.RecordTypeA, "1.1.1.1")},
+	})
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "apply_changes", timeoutErr.Operation, "the sync exceeds its timeout")
+	assert.ErrorContains(t, err, "apply_changes timed out after 50ms")
+}
@@ -0,0 +1,144 @@
+package ionoscloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+const (
+	// part of the token lifetime after which the token is refreshed
+	tokenRefreshRatio = 0.8
+	// default min time between two attempts to obtain a token
+	tokenRetryInterval = 30 * time.Second
+	// timeout of a request to the auth API
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// tokenSource obtains short-lived tokens from the IONOS auth API with username and password. The credentials are read
+// for every token, so that files with rotated credentials are picked up.
+type tokenSource struct {
+	authURL      string
+	username     string
+	usernameFile string
+	password     string
+	passwordFile string
+	ttl          time.Duration
+	httpClient   *http.Client
+	now          func() time.Time
+	// min time between two attempts to obtain a token
+	retryInterval time.Duration
+}
+
+func newTokenSource(configuration *ionos.Configuration, httpClient *http.Client) *tokenSource {
+	return &tokenSource{
+		authURL:       strings.TrimSuffix(configuration.AuthAPIURL, "/"),
+		username:      configuration.Username,
+		usernameFile:  configuration.UsernameFile,
+		password:      configuration.Password,
+		passwordFile:  configuration.PasswordFile,
+		ttl:           configuration.TokenTTL,
+		httpClient:    httpClient,
+		now:           time.Now,
+		retryInterval: tokenRetryInterval,
+	}
+}
+
+func (s *tokenSource) credentials() (string, string, error) {
+	username, password := s.username, s.password
+	var err error
+	if s.usernameFile != "" {
+		if username, err = ionos.ReadSecretFile(s.usernameFile); err != nil {
+			return "", "", err
+		}
+	}
+	if s.passwordFile != "" {
+		if password, err = ionos.ReadSecretFile(s.passwordFile); err != nil {
+			return "", "", err
+		}
+	}
+	return username, password, nil
+}
+
+// token generates a new token https://api.ionos.com/docs/authentication/v1/#tag/tokens/operation/tokensGenerate
+func (s *tokenSource) token(ctx context.Context) (string, error) {
+	username, password, err := s.credentials()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, tokenRequestTimeout)
+	defer cancel()
+	query := url.Values{}
+	if s.ttl > 0 {
+		query.Set("ttl", strconv.Itoa(int(s.ttl.Seconds())))
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.authURL+"/tokens/generate?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth(username, password)
+	request.Header.Set("Accept", "application/json")
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to request a token: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", ionos.NewAPIError(response.StatusCode, fmt.Errorf("failed to request a token: %s", response.Status))
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode the token response: %w", err)
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("the token response contains no token")
+	}
+	return body.Token, nil
+}
+
+// refreshIn returns the time until the token should be refreshed.
+func (s *tokenSource) refreshIn(token string) time.Duration {
+	lifetime := s.ttl
+	now := s.now()
+	if expiresAt, ok := ionos.TokenExpiry(token); ok {
+		lifetime = expiresAt.Sub(now)
+	}
+	return max(time.Duration(float64(lifetime)*tokenRefreshRatio), s.retryInterval)
+}
+
+// startRefresh refreshes the token in the background until the context is done and calls rotate with every new token.
+// A failed refresh is retried, the current token stays in use until then.
+func (s *tokenSource) startRefresh(ctx context.Context, token string, rotate func(token string)) {
+	go func() {
+		timer := time.NewTimer(s.refreshIn(token))
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				newToken, err := s.token(ctx)
+				if err != nil {
+					log.Warnf("failed to refresh the API token, retrying in %s: %v", s.retryInterval, err)
+					timer.Reset(s.retryInterval)
+					continue
+				}
+				rotate(newToken)
+				token = newToken
+				log.Info("refreshed the API token")
+				timer.Reset(s.refreshIn(token))
+			}
+		}
+	}()
+}
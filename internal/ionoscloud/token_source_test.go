@@ -0,0 +1,124 @@
+package ionoscloud
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+func newAuthServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTokenSourceToken(t *testing.T) {
+	authServer := newAuthServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/auth/v1/tokens/generate", r.URL.Path)
+		assert.Equal(t, "3600", r.URL.Query().Get("ttl"))
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"new.token"}`))
+	})
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("secret\n"), 0o600))
+	configuration := &ionos.Configuration{
+		Username:     "user",
+		PasswordFile: passwordFile,
+		AuthAPIURL:   authServer.URL + "/auth/v1/",
+		TokenTTL:     time.Hour,
+	}
+
+	token, err := newTokenSource(configuration, http.DefaultClient).token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "new.token", token)
+
+	require.NoError(t, os.WriteFile(passwordFile, []byte("wrong"), 0o600))
+	_, err = newTokenSource(configuration, http.DefaultClient).token(context.Background())
+	var apiErr *ionos.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestTokenSourceRefreshIn(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	source := &tokenSource{ttl: time.Hour, now: func() time.Time { return now }, retryInterval: time.Minute}
+	tokenExpiringIn := func(d time.Duration) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, now.Add(d).Unix()))) + ".signature"
+	}
+
+	assert.Equal(t, 80*time.Minute, source.refreshIn(tokenExpiringIn(100*time.Minute)))
+	assert.Equal(t, 48*time.Minute, source.refreshIn("no.jwt"), "without exp claim the ttl is used")
+	assert.Equal(t, time.Minute, source.refreshIn(tokenExpiringIn(-time.Hour)), "the refresh is not retried faster than the retry interval")
+}
+
+func TestTokenSourceStartRefresh(t *testing.T) {
+	var requests atomic.Int32
+	authServer := newAuthServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"refreshed.token"}`))
+	})
+	source := newTokenSource(&ionos.Configuration{Username: "user", Password: "secret", AuthAPIURL: authServer.URL, TokenTTL: time.Millisecond}, http.DefaultClient)
+	source.retryInterval = 5 * time.Millisecond
+	rotated := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source.startRefresh(ctx, "initial.token", func(token string) {
+		select {
+		case rotated <- token:
+		default:
+		}
+	})
+
+	select {
+	case token := <-rotated:
+		assert.Equal(t, "refreshed.token", token)
+		assert.GreaterOrEqual(t, requests.Load(), int32(2), "the failed refresh is retried")
+	case <-time.After(time.Second):
+		t.Fatal("the token was not refreshed")
+	}
+}
+
+func TestNewProviderWithRejectedCredentials(t *testing.T) {
+	authServer := newAuthServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	_, err := NewProvider(nil, &ionos.Configuration{Username: "user", Password: "wrong", AuthAPIURL: authServer.URL})
+	var apiErr *ionos.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.ErrorContains(t, err, "failed to obtain a token from the IONOS auth API")
+}
+
+func TestNewProviderKeepsTheObtainedToken(t *testing.T) {
+	authServer := newAuthServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"token":"new.token"}`))
+	})
+	configuration := &ionos.Configuration{Username: "user", Password: "secret", AuthAPIURL: authServer.URL, TokenTTL: time.Hour}
+
+	prov, err := NewProvider(nil, configuration)
+	require.NoError(t, err)
+	defer prov.Close()
+	assert.Equal(t, "new.token", prov.APIKey())
+	assert.Empty(t, configuration.APIKey, "the configuration of the caller is not changed")
+}
@@ -0,0 +1,159 @@
+package ionoscloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+	sdk "github.com/ionos-cloud/sdk-go-dns"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// interval for polling the provisioning state of a newly created zone
+	zoneCreatePollInterval = 5 * time.Second
+
+	recordTypeNS = "NS"
+)
+
+// zoneCreator holds the settings for the automatic creation of missing zones, it is disabled without patterns.
+type zoneCreator struct {
+	patterns     []string
+	timeout      time.Duration
+	pollInterval time.Duration
+	delegation   bool
+}
+
+func (zc zoneCreator) enabled() bool {
+	return len(zc.patterns) > 0
+}
+
+// createMissingZones creates the zones for all endpoints which match one of the configured zone patterns but are not
+// covered by an existing zone with at least the name derived from the pattern. New zones are added to the given zone tree.
+func (p *Provider) createMissingZones(ctx context.Context, zt *ionos.ZoneTree[sdk.ZoneRead], endpoints []*endpoint.Endpoint) error {
+	if !p.zoneCreator.enabled() {
+		return nil
+	}
+	for _, ep := range endpoints {
+		zoneName := ionos.MatchZonePattern(p.zoneCreator.patterns, ep.DNSName)
+		if zoneName == "" {
+			continue
+		}
+		logger := log.WithField(logFieldRecordFQDN, ep.DNSName).WithField(logFieldZoneName, zoneName)
+		parentZone := zt.FindZoneByDomainName(zoneName)
+		if parentZone.HasId() && *parentZone.GetProperties().GetZoneName() == zoneName {
+			continue
+		}
+		if !p.domainFilter.Match(zoneName) || !p.zoneFilter.MatchName(zoneName) {
+			logger.Warn("zone matches auto create patterns but not the domain or zone filter, skipping zone creation")
+			continue
+		}
+		if p.zoneFilter.HasZoneIDs() {
+			// the id of the new zone would not match the filter, so its records would never be read
+			logger.Warn("zone matches auto create patterns but a zone id filter is configured, skipping zone creation")
+			continue
+		}
+		zone, err := p.findOrCreateZone(ctx, zoneName)
+		if err != nil {
+			return err
+		}
+		if !zone.HasId() {
+			continue
+		}
+		zt.AddZone(zone, zoneName)
+		if p.zoneCreator.delegation && parentZone.HasId() {
+			if err := p.createDelegation(ctx, parentZone, zone); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findOrCreateZone waits for an existing zone with the name in any provisioning state, e.g. a zone created by a previous
+// sync, which was not available within the timeout. Otherwise it creates the zone and waits until it is provisioned.
+func (p *Provider) findOrCreateZone(ctx context.Context, zoneName string) (sdk.ZoneRead, error) {
+	logger := log.WithField(logFieldZoneName, zoneName)
+	zones, err := p.client.GetZonesByName(ctx, zoneName)
+	if err != nil {
+		return sdk.ZoneRead{}, fmt.Errorf("failed to look up zone '%s': %w", zoneName, err)
+	}
+	if zones.HasItems() {
+		for _, zone := range *zones.GetItems() {
+			if zone.HasId() && zone.HasProperties() && *zone.GetProperties().GetZoneName() == zoneName {
+				logger.Infof("zone exists in state '%s', not creating it again", zoneState(zone))
+				return p.waitForZoneAvailable(ctx, *zone.GetId(), zoneName)
+			}
+		}
+	}
+	logger.Info("no zone found for record, creating zone ...")
+	zone, err := p.client.CreateZone(ctx, zoneName)
+	entry := ionos.AuditEntry{Action: ionos.AuditActionCreateZone, Zone: zoneName}
+	if zone.HasId() {
+		entry.ZoneID = *zone.GetId()
+	}
+	p.audit.Log(ctx, entry, err)
+	if err != nil {
+		return zone, fmt.Errorf("failed to create zone '%s': %w", zoneName, err)
+	}
+	if !zone.HasId() {
+		return zone, nil
+	}
+	return p.waitForZoneAvailable(ctx, *zone.GetId(), zoneName)
+}
+
+// waitForZoneAvailable polls the zone until its provisioning state is AVAILABLE, fails or the timeout is exceeded.
+func (p *Provider) waitForZoneAvailable(ctx context.Context, zoneId, zoneName string) (sdk.ZoneRead, error) {
+	logger := log.WithField(logFieldZoneID, zoneId).WithField(logFieldZoneName, zoneName)
+	ctx, cancel := context.WithTimeout(ctx, p.zoneCreator.timeout)
+	defer cancel()
+	ticker := time.NewTicker(p.zoneCreator.pollInterval)
+	defer ticker.Stop()
+	for {
+		zone, err := p.client.GetZone(ctx, zoneId)
+		if err != nil {
+			return zone, fmt.Errorf("failed to read state of zone '%s': %w", zoneName, err)
+		}
+		state := zoneState(zone)
+		switch state {
+		case sdk.PROVISIONINGSTATE_AVAILABLE:
+			logger.Info("zone is available")
+			return zone, nil
+		case sdk.PROVISIONINGSTATE_FAILED:
+			return zone, fmt.Errorf("provisioning of zone '%s' failed", zoneName)
+		}
+		logger.Debugf("zone is in state '%s', waiting ...", state)
+		select {
+		case <-ctx.Done():
+			return zone, fmt.Errorf("zone '%s' not available after %v: %w", zoneName, p.zoneCreator.timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// createDelegation creates the NS records of the child zone in the parent zone.
+func (p *Provider) createDelegation(ctx context.Context, parentZone, childZone sdk.ZoneRead) error {
+	childZoneName := *childZone.GetProperties().GetZoneName()
+	nameservers := childZone.GetMetadata().GetNameservers()
+	if nameservers == nil || len(*nameservers) == 0 {
+		log.WithField(logFieldZoneName, childZoneName).Warn("zone has no nameservers, skipping delegation")
+		return nil
+	}
+	recordName := extractRecordName(childZoneName, parentZone)
+	for _, nameserver := range *nameservers {
+		record := sdk.NewRecord(recordName, recordTypeNS, nameserver)
+		if err := p.createRecord(ctx, parentZone, *sdk.NewRecordCreate(*record)); err != nil {
+			return fmt.Errorf("failed to delegate zone '%s': %w", childZoneName, err)
+		}
+	}
+	return nil
+}
+
+func zoneState(zone sdk.ZoneRead) sdk.ProvisioningState {
+	if metadata, ok := zone.GetMetadataOk(); ok && metadata.HasState() {
+		return *metadata.GetState()
+	}
+	return ""
+}
@@ -0,0 +1,237 @@
+package ionoscloud
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+	sdk "github.com/ionos-cloud/sdk-go-dns"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChangesWithZoneAutoCreate(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	testCases := []struct {
+		name                   string
+		givenZones             sdk.ZoneReadList
+		givenZoneCreator       zoneCreator
+		givenDomainFilter      *endpoint.DomainFilter
+		givenZoneFilter        *ionos.ZoneFilter
+		whenDNSName            string
+		expectedZonesCreated   []string
+		expectedRecordsCreated map[string][]string // zoneId -> record names
+	}{
+		{
+			name:                   "auto create disabled",
+			givenZones:             createZoneReadList(0, nil),
+			givenZoneCreator:       zoneCreator{},
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   nil,
+			expectedRecordsCreated: map[string][]string{},
+		},
+		{
+			name:                   "create missing zone",
+			givenZones:             createZoneReadList(0, nil),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   []string{"acme.customers.de"},
+			expectedRecordsCreated: map[string][]string{"acme.customers.deId": {"www"}},
+		},
+		{
+			name:                   "endpoint does not match any pattern",
+			givenZones:             createZoneReadList(0, nil),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			whenDNSName:            "www.acme.partners.de",
+			expectedZonesCreated:   nil,
+			expectedRecordsCreated: map[string][]string{},
+		},
+		{
+			name: "zone already exists",
+			givenZones: createZoneReadList(1, func(int) (string, string) {
+				return "acmeZoneId", "acme.customers.de"
+			}),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   nil,
+			expectedRecordsCreated: map[string][]string{"acmeZoneId": {"www"}},
+		},
+		{
+			name:                   "zone excluded by domain filter",
+			givenZones:             createZoneReadList(0, nil),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			givenDomainFilter:      endpoint.NewDomainFilterWithExclusions([]string{}, []string{"acme.customers.de"}),
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   nil,
+			expectedRecordsCreated: map[string][]string{},
+		},
+		{
+			name:                   "zone id filter configured",
+			givenZones:             createZoneReadList(0, nil),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			givenZoneFilter:        ionos.NewZoneFilter([]string{"otherZoneId"}, nil, nil),
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   nil,
+			expectedRecordsCreated: map[string][]string{},
+		},
+		{
+			name: "create zone without delegation in parent zone",
+			givenZones: createZoneReadList(1, func(int) (string, string) {
+				return "parentZoneId", "customers.de"
+			}),
+			givenZoneCreator:       zoneCreator{patterns: []string{"*.customers.de"}},
+			whenDNSName:            "www.acme.customers.de",
+			expectedZonesCreated:   []string{"acme.customers.de"},
+			expectedRecordsCreated: map[string][]string{"acme.customers.deId": {"www"}},
+		},
+		{
+			name: "create zone with delegation in parent zone",
+			givenZones: createZoneReadList(1, func(int) (string, string) {
+				return "parentZoneId", "customers.de"
+			}),
+			givenZoneCreator:     zoneCreator{patterns: []string{"*.customers.de"}, delegation: true},
+			whenDNSName:          "www.acme.customers.de",
+			expectedZonesCreated: []string{"acme.customers.de"},
+			expectedRecordsCreated: map[string][]string{
+				"acme.customers.deId": {"www"},
+				"parentZoneId":        {"acme", "acme"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDnsClient := &mockDNSClient{allZones: tc.givenZones}
+			tc.givenZoneCreator.timeout = time.Second
+			tc.givenZoneCreator.pollInterval = time.Millisecond
+			prov := &Provider{client: mockDnsClient, domainFilter: tc.givenDomainFilter, zoneFilter: tc.givenZoneFilter,
+				zoneCreator: tc.givenZoneCreator}
+			err := prov.ApplyChanges(ctx, &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint(tc.whenDNSName, "A", "1.2.3.4")},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedZonesCreated, mockDnsClient.createdZones)
+			actualRecordsCreated := map[string][]string{}
+			for zoneId, records := range mockDnsClient.createdRecords {
+				for _, record := range records {
+					actualRecordsCreated[zoneId] = append(actualRecordsCreated[zoneId], *record.GetProperties().GetName())
+				}
+			}
+			assert.Equal(t, tc.expectedRecordsCreated, actualRecordsCreated)
+		})
+	}
+}
+
+func TestApplyChangesWithZoneAutoCreateWaitsForProvisioningZone(t *testing.T) {
+	zone := createZoneReadList(1, func(int) (string, string) { return "acmeZoneId", "acme.customers.de" })
+	provisioningZone := (*zone.GetItems())[0]
+	provisioningZone.SetMetadata(*sdk.NewMetadataWithStateNameservers(sdk.PROVISIONINGSTATE_PROVISIONING, nil))
+	client := &provisioningMockDNSClient{
+		mockDNSClient: mockDNSClient{allZones: createZoneReadList(0, nil), provisioningZones: []sdk.ZoneRead{provisioningZone}},
+		states:        []sdk.ProvisioningState{sdk.PROVISIONINGSTATE_PROVISIONING, sdk.PROVISIONINGSTATE_AVAILABLE},
+	}
+	prov := &Provider{client: client, domainFilter: &endpoint.DomainFilter{}, zoneCreator: zoneCreator{
+		patterns: []string{"*.customers.de"}, timeout: time.Second, pollInterval: time.Millisecond,
+	}}
+	err := prov.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.acme.customers.de", "A", "1.2.3.4")},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, client.createdZones, "the zone created by a previous sync is not created again")
+	assert.Len(t, client.createdRecords["acmeZoneId"], 1)
+}
+
+func TestApplyChangesWithZoneAutoCreateAudit(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := ionos.NewAuditLog(auditFile, 10, 1, auditBackend, false)
+	require.NoError(t, err)
+	client := &mockDNSClient{allZones: createZoneReadList(0, nil)}
+	prov := &Provider{client: client, domainFilter: &endpoint.DomainFilter{}, audit: audit, zoneCreator: zoneCreator{
+		patterns: []string{"*.customers.de"}, timeout: time.Second, pollInterval: time.Millisecond,
+	}}
+	err = prov.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.acme.customers.de", "A", "1.2.3.4")},
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 3)
+	var entry ionos.AuditEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, ionos.AuditActionCreateZone, entry.Action)
+	assert.Equal(t, "acme.customers.de", entry.Zone)
+	assert.Equal(t, "acme.customers.deId", entry.ZoneID)
+	assert.Equal(t, "success", entry.Result)
+}
+
+func TestWaitForZoneAvailable(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenStates   []sdk.ProvisioningState
+		expectedCalls int
+		expectedError string
+	}{
+		{
+			name:          "available after provisioning",
+			givenStates:   []sdk.ProvisioningState{sdk.PROVISIONINGSTATE_PROVISIONING, sdk.PROVISIONINGSTATE_PROVISIONING, sdk.PROVISIONINGSTATE_AVAILABLE},
+			expectedCalls: 3,
+		},
+		{
+			name:          "provisioning failed",
+			givenStates:   []sdk.ProvisioningState{sdk.PROVISIONINGSTATE_PROVISIONING, sdk.PROVISIONINGSTATE_FAILED},
+			expectedCalls: 2,
+			expectedError: "provisioning of zone 'a.de' failed",
+		},
+		{
+			name:          "timeout",
+			givenStates:   []sdk.ProvisioningState{sdk.PROVISIONINGSTATE_PROVISIONING},
+			expectedError: "zone 'a.de' not available after 50ms: context deadline exceeded",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &provisioningMockDNSClient{states: tc.givenStates}
+			prov := &Provider{client: client, zoneCreator: zoneCreator{timeout: 50 * time.Millisecond, pollInterval: time.Millisecond}}
+			_, err := prov.waitForZoneAvailable(context.Background(), "aZoneId", "a.de")
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.expectedCalls > 0 {
+				assert.Equal(t, tc.expectedCalls, client.calls)
+			}
+		})
+	}
+}
+
+// provisioningMockDNSClient returns the given provisioning states one after another, the last one is repeated.
+type provisioningMockDNSClient struct {
+	mockDNSClient
+	states []sdk.ProvisioningState
+	calls  int
+}
+
+func (c *provisioningMockDNSClient) GetZone(ctx context.Context, zoneId string) (sdk.ZoneRead, error) {
+	state := c.states[min(c.calls, len(c.states)-1)]
+	c.calls++
+	zone := sdk.NewZoneReadWithDefaults()
+	zone.SetId(zoneId)
+	for _, provisioningZone := range c.provisioningZones {
+		if *provisioningZone.GetId() == zoneId {
+			zone.SetProperties(*provisioningZone.GetProperties())
+		}
+	}
+	zone.SetMetadata(*sdk.NewMetadataWithStateNameservers(state, nil))
+	return *zone, nil
+}
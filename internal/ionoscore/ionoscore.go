@@ -2,82 +2,201 @@ package ionoscore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 
 	log "github.com/sirupsen/logrus"
 
 	sdk "github.com/ionos-developer/dns-sdk-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 )
 
+const auditBackend = "ionos-core"
+
 // Provider implements the DNS provider for IONOS DNS.
 type Provider struct {
 	provider.BaseProvider
 	client       DnsService
 	dryRun       bool
 	domainFilter endpoint.DomainFilterInterface
+	zoneFilter   *ionos.ZoneFilter
+	account      string
+	protection   *ionos.RecordProtection
+	guard        *ionos.DeletionGuard
+	deferred     *ionos.DeferredDeletions
+	audit        *ionos.AuditLog
+	// domain filter for external-dns, restricted to the discovered zones
+	zoneDomainFilter *ionos.ZoneDomainFilter
+	// limits each Records and ApplyChanges call
+	syncTimeout time.Duration
+	// stops the background work
+	stop context.CancelFunc
 }
 
 // DnsService interface to the dns backend, also needed for creating mocks in tests
 type DnsService interface {
 	GetZones(ctx context.Context) ([]sdk.Zone, error)
 	GetZone(ctx context.Context, zoneId string) (*sdk.CustomerZone, error)
-	CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) error
+	CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) ([]sdk.RecordResponse, error)
 	DeleteRecord(ctx context.Context, zoneId string, recordId string) error
 }
 
 // DnsClient client of the dns api
 type DnsClient struct {
-	client *sdk.APIClient
+	// replaced when the API key is rotated, requests in flight complete with the previous client
+	client atomic.Pointer[sdk.APIClient]
+	// limits each API call
+	timeout time.Duration
+}
+
+func newDnsClient(client *sdk.APIClient, timeout time.Duration) *DnsClient {
+	dnsClient := &DnsClient{timeout: timeout}
+	dnsClient.client.Store(client)
+	return dnsClient
+}
+
+// startSpan starts the span of a client method.
+func startSpan(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return ionos.StartSpan(ctx, "ionoscore.DnsClient."+operation, append(attributes, ionos.AttributeBackend.String(ionos.BackendCore))...)
+}
+
+// observeAPICall records the metrics and the span attributes of an API call made with callCtx, the response is nil if
+// the request failed. It returns err as ionos.APIError with the status code of the response, or as ionos.TimeoutError
+// if the call exceeded the timeout of the client.
+func (c *DnsClient) observeAPICall(ctx, callCtx context.Context, span trace.Span, operation string, start time.Time, response *http.Response, err error) error {
+	statusCode := 0
+	if response != nil {
+		statusCode = response.StatusCode
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	ionos.RecordSpanError(span, err)
+	ionos.ObserveAPICall(ionos.BackendCore, operation, start, statusCode, err)
+	return ionos.NewAPIError(statusCode, ionos.NewTimeoutError(ctx, callCtx, operation, c.timeout, err))
 }
 
 // GetZones client get zones method
-func (c DnsClient) GetZones(ctx context.Context) ([]sdk.Zone, error) {
-	zones, _, err := c.client.ZonesApi.GetZones(ctx).Execute()
+func (c *DnsClient) GetZones(ctx context.Context) ([]sdk.Zone, error) {
+	ctx, span := startSpan(ctx, "GetZones")
+	defer span.End()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zones, response, err := c.client.Load().ZonesApi.GetZones(callCtx).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetZones", start, response, err)
 	return zones, err
 }
 
 // GetZone client get zone method
-func (c DnsClient) GetZone(ctx context.Context, zoneId string) (*sdk.CustomerZone, error) {
-	zoneInfo, _, err := c.client.ZonesApi.GetZone(ctx, zoneId).Execute()
+func (c *DnsClient) GetZone(ctx context.Context, zoneId string) (*sdk.CustomerZone, error) {
+	ctx, span := startSpan(ctx, "GetZone", ionos.AttributeZoneID.String(zoneId))
+	defer span.End()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	zoneInfo, response, err := c.client.Load().ZonesApi.GetZone(callCtx, zoneId).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "GetZone", start, response, err)
 	return zoneInfo, err
 }
 
 // CreateRecords client create records method
-func (c DnsClient) CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) error {
-	_, _, err := c.client.RecordsApi.CreateRecords(ctx, zoneId).Record(records).Execute()
-	return err
+func (c *DnsClient) CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) ([]sdk.RecordResponse, error) {
+	ctx, span := startSpan(ctx, "CreateRecords", ionos.AttributeZoneID.String(zoneId), attribute.Int("dns.record.count", len(records)))
+	defer span.End()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	created, response, err := c.client.Load().RecordsApi.CreateRecords(callCtx, zoneId).Record(records).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "CreateRecords", start, response, err)
+	return created, err
 }
 
 // DeleteRecord client delete record method
-func (c DnsClient) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
-	_, err := c.client.RecordsApi.DeleteRecord(ctx, zoneId, recordId).Execute()
+func (c *DnsClient) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
+	ctx, span := startSpan(ctx, "DeleteRecord", ionos.AttributeZoneID.String(zoneId), ionos.AttributeRecordID.String(recordId))
+	defer span.End()
+	start := time.Now()
+	callCtx, cancel := ionos.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	response, err := c.client.Load().RecordsApi.DeleteRecord(callCtx, zoneId, recordId).Execute()
+	err = c.observeAPICall(ctx, callCtx, span, "DeleteRecord", start, response, err)
 	return err
 }
 
 var _ provider.Provider = (*Provider)(nil)
 
-// NewProvider creates a new IONOS DNS provider.
-func NewProvider(domanfilter endpoint.DomainFilterInterface, configuration *ionos.Configuration) *Provider {
-	client := createClient(configuration)
+// NewProvider creates a new IONOS DNS provider. The background work runs until the provider is closed.
+func NewProvider(domanfilter endpoint.DomainFilterInterface, configuration *ionos.Configuration) (*Provider, error) {
+	httpClient, err := ionos.NewHTTPClient(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	client := newDnsClient(createClient(configuration, httpClient), configuration.APITimeout)
+	audit, err := ionos.NewAuditLog(configuration.AuditLog, configuration.AuditLogMaxSizeMB, configuration.AuditLogMaxBackups,
+		auditBackend, configuration.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log: %w", err)
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	prov := &Provider{
-		client:       DnsClient{client: client},
+		client:       client,
 		dryRun:       configuration.DryRun,
 		domainFilter: domanfilter,
+		zoneFilter:   ionos.NewZoneFilter(configuration.ZoneIDFilter, configuration.ZoneNameFilter, configuration.ExcludeZoneNameFilter),
+		account:      configuration.Account,
+		protection:   ionos.NewRecordProtection(configuration.ProtectedRecords, configuration.ProtectApexNS),
+		guard: ionos.NewDeletionGuard(configuration.DeletionGuardMaxCount, configuration.DeletionGuardMaxPercent,
+			configuration.DeletionGuardMode, configuration.DeletionGuardOverrideFile),
+		deferred:    ionos.NewDeferredDeletions(configuration.DeletionGracePeriod, configuration.DeletionStateFile, configuration.Account),
+		audit:       audit,
+		syncTimeout: configuration.SyncTimeout,
+		stop:        cancel,
 	}
+	if configuration.ZoneDiscoveryInterval > 0 {
+		prov.zoneDomainFilter = ionos.NewZoneDomainFilter(domanfilter, nil)
+		prov.zoneDomainFilter.StartRefresh(ctx, configuration.ZoneDiscoveryInterval, prov.readZoneNames)
+	}
+	if configuration.APIKeyFile != "" {
+		ionos.WatchAPIKeyFile(ctx, configuration.APIKeyFile, configuration.APIKeyFileInterval, configuration.APIKey,
+			func(ctx context.Context, apiKey string) error {
+				rotated := *configuration
+				rotated.APIKey = apiKey
+				sdkClient := createClient(&rotated, httpClient)
+				// the key must be accepted by the API, before it replaces the current one
+				if _, err := newDnsClient(sdkClient, configuration.APITimeout).GetZones(ctx); err != nil {
+					return err
+				}
+				client.client.Store(sdkClient)
+				return nil
+			})
+	}
+
+	return prov, nil
+}
 
-	return prov
+// Close stops the background work of the provider and closes the audit log.
+func (p *Provider) Close() {
+	if p.stop != nil {
+		p.stop()
+	}
+	if err := p.audit.Close(); err != nil {
+		log.Warnf("failed to close audit log: %v", err)
+	}
 }
 
-func createClient(config *ionos.Configuration) *sdk.APIClient {
+func createClient(config *ionos.Configuration, httpClient *http.Client) *sdk.APIClient {
 	maskAPIKey := func() string {
 		if len(config.APIKey) <= 3 {
 			return strings.Repeat("*", len(config.APIKey))
@@ -103,22 +222,36 @@ func createClient(config *ionos.Configuration) *sdk.APIClient {
 	sdkConfig.UserAgent = fmt.Sprintf(
 		"external-dns os %s arch %s",
 		runtime.GOOS, runtime.GOARCH)
-	sdkConfig.Debug = config.Debug
+	// the requests are logged by the HTTP client with redacted credentials, the SDK would dump them unredacted
+	sdkConfig.Debug = false
+	// propagates the trace context and creates a span per HTTP request
+	sdkConfig.HTTPClient = httpClient
 
 	return sdk.NewAPIClient(sdkConfig)
 }
 
-// Records returns the list of resource records in all zones.
+// Records returns the list of resource records in all zones, it fails if they are not read within the sync timeout.
 func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	syncCtx, done := ionos.StartSync(ctx, ionos.BackendCore, "records", p.syncTimeout)
+	endpoints, err := p.records(syncCtx)
+	return endpoints, done(err)
+}
+
+func (p *Provider) records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	zones, err := p.getZones(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var endpoints []*endpoint.Endpoint
+	recordCounts := make(map[string]map[string]int)
 
 	for zoneId := range zones {
 		zoneInfo, err := p.client.GetZone(ctx, zoneId)
+		if ionos.IsTimeout(err) {
+			// the records of the zone would be missing, although the API is just slow
+			return nil, err
+		}
 		if err != nil {
 			log.Warnf("Failed to fetch zoneId %v: %v", zoneId, err)
 			continue
@@ -126,6 +259,14 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 
 		recordSets := map[string]*endpoint.Endpoint{}
 		for _, r := range zoneInfo.Records {
+			if recordCounts[*zoneInfo.Name] == nil {
+				recordCounts[*zoneInfo.Name] = make(map[string]int)
+			}
+			recordCounts[*zoneInfo.Name][getType(r)]++
+			if p.protection.IsProtected(*r.Name, getType(r), *zoneInfo.Name) {
+				log.Debugf("Hiding protected record %v %v", *r.Name, getType(r))
+				continue
+			}
 			key := *r.Name + "/" + getType(r) + "/" + strconv.Itoa(int(*r.Ttl))
 			if rrset, ok := recordSets[key]; ok {
 				rrset.Targets = append(rrset.Targets, *r.Content)
@@ -138,17 +279,52 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 			endpoints = append(endpoints, ep)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		// the zones skipped after the cancellation would be missing
+		return nil, fmt.Errorf("failed to read the records of all zones: %w", err)
+	}
 	log.Debugf("Records() found %d endpoints: %v", len(endpoints), endpoints)
+	ionos.SetManagedRecords(ionos.BackendCore, p.account, recordCounts)
+	ionos.SetLastSuccess(ionos.BackendCore, p.account, "records")
 	return endpoints, nil
 }
 
-// ApplyChanges applies a given set of changes.
+// ApplyChanges applies a given set of changes, the remaining changes are cancelled after the sync timeout.
 func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	syncCtx, done := ionos.StartSync(ctx, ionos.BackendCore, "apply_changes", p.syncTimeout)
+	return done(p.applyChanges(syncCtx, changes))
+}
+
+func (p *Provider) applyChanges(ctx context.Context, changes *plan.Changes) error {
+	ctx = ionos.WithPlanID(ctx)
 	zones, err := p.getZones(ctx)
 	if err != nil {
 		return err
 	}
 
+	zoneNameOf := func(dnsName string) string {
+		return zones[getHostZoneID(dnsName, zones)]
+	}
+	changes = p.protection.FilterChanges(changes, zoneNameOf)
+	// the guard checks all planned deletions including the deferred ones, refused deletions stay pending
+	guarded, err := p.guard.Check(changes, zoneNameOf, func(zoneName string) (int, error) {
+		for zoneId, name := range zones {
+			if name == zoneName {
+				zoneInfo, err := p.client.GetZone(ctx, zoneId)
+				if err != nil {
+					return 0, err
+				}
+				return len(zoneInfo.Records), nil
+			}
+		}
+		return 0, nil
+	})
+	changes = p.deferred.Filter(changes, guarded)
+	if err != nil {
+		return err
+	}
+	p.audit.LogPlan(ctx, changes)
+
 	toCreate := make([]*endpoint.Endpoint, len(changes.Create))
 	copy(toCreate, changes.Create)
 
@@ -164,6 +340,8 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 
 	zonesToDeleteFrom := p.fetchZonesToDeleteFrom(ctx, toDelete, zones)
 
+	// the remaining changes are applied after a failed one, the failures are returned together
+	var errs []error
 	for _, e := range toDelete {
 		zoneId := getHostZoneID(e.DNSName, zones)
 		if zoneId == "" {
@@ -172,16 +350,26 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 		}
 
 		if zone, ok := zonesToDeleteFrom[zoneId]; ok {
-			p.deleteEndpoint(ctx, e, zone)
+			if err := p.deleteEndpoint(ctx, e, zone); err != nil {
+				errs = append(errs, err)
+			} else {
+				p.deferred.Done(e)
+			}
 		} else {
 			log.Warnf("No zone to delete %v from", e)
 		}
 	}
 
 	for _, e := range toCreate {
-		p.createEndpoint(ctx, e, zones)
+		if err := p.createEndpoint(ctx, e, zones); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	ionos.SetLastSuccess(ionos.BackendCore, p.account, "apply_changes")
 	return nil
 }
 
@@ -206,50 +394,80 @@ func (p *Provider) fetchZonesToDeleteFrom(ctx context.Context, toDelete []*endpo
 	return zonesToDeleteFrom
 }
 
-// deleteEndpoint deletes all resource records for the endpoint through the IONOS DNS API.
-func (p *Provider) deleteEndpoint(ctx context.Context, e *endpoint.Endpoint, zone *sdk.CustomerZone) {
+// deleteEndpoint deletes all resource records for the endpoint through the IONOS DNS API, it returns the errors of the
+// records, whose deletion failed.
+func (p *Provider) deleteEndpoint(ctx context.Context, e *endpoint.Endpoint, zone *sdk.CustomerZone) error {
 	log.Infof("Delete endpoint %v", e)
-	if p.dryRun {
-		return
-	}
+	var errs []error
 
 	for _, target := range e.Targets {
-		recordId := ""
+		var recordToDelete *sdk.RecordResponse
 		for _, record := range zone.Records {
 			if *record.Name == e.DNSName && getType(record) == e.RecordType && *record.Content == target {
-				recordId = *record.Id
+				recordToDelete = &record
 				break
 			}
 		}
 
-		if recordId == "" {
+		if recordToDelete == nil {
 			log.Warnf("Record %v %v %v not found in zone", e.DNSName, e.RecordType, target)
 			continue
 		}
 
-		if p.client.DeleteRecord(ctx, *zone.Id, recordId) != nil {
+		var err error
+		if !p.dryRun {
+			err = p.client.DeleteRecord(ctx, *zone.Id, *recordToDelete.Id)
+		}
+		p.audit.Log(ctx, ionos.AuditEntry{
+			Action:   ionos.AuditActionDelete,
+			Zone:     *zone.Name,
+			ZoneID:   *zone.Id,
+			RecordID: *recordToDelete.Id,
+			Before:   auditRecord(*recordToDelete),
+		}, err)
+		if err != nil {
 			log.Warnf("Failed to delete record %v %v %v", e.DNSName, e.RecordType, target)
+			errs = append(errs, fmt.Errorf("failed to delete record %v %v %v: %w", e.DNSName, e.RecordType, target, err))
 		}
 	}
+	return errors.Join(errs...)
 }
 
 // createEndpoint creates the record set for the endpoint using the IONOS DNS API.
-func (p *Provider) createEndpoint(ctx context.Context, e *endpoint.Endpoint, zones map[string]string) {
+func (p *Provider) createEndpoint(ctx context.Context, e *endpoint.Endpoint, zones map[string]string) error {
 	log.Infof("Create endpoint %v", e)
-	if p.dryRun {
-		return
-	}
 
 	zoneId := getHostZoneID(e.DNSName, zones)
 	if zoneId == "" {
 		log.Warnf("No zone to create %v into", e)
-		return
+		return nil
 	}
 
 	records := endpointToRecords(e)
-	if p.client.CreateRecords(ctx, zoneId, records) != nil {
+	var created []sdk.RecordResponse
+	var err error
+	if !p.dryRun {
+		created, err = p.client.CreateRecords(ctx, zoneId, records)
+	}
+	for _, record := range records {
+		entry := ionos.AuditEntry{
+			Action: ionos.AuditActionCreate,
+			Zone:   zones[zoneId],
+			ZoneID: zoneId,
+			After:  &ionos.AuditRecord{Name: record.GetName(), Type: string(record.GetType()), Content: record.GetContent(), TTL: record.GetTtl()},
+		}
+		for _, c := range created {
+			if c.GetName() == record.GetName() && c.GetType() == record.GetType() && c.GetContent() == record.GetContent() {
+				entry.RecordID = c.GetId()
+			}
+		}
+		p.audit.Log(ctx, entry, err)
+	}
+	if err != nil {
 		log.Warnf("Failed to create record for %v", e)
+		return fmt.Errorf("failed to create records for %v %v: %w", e.DNSName, e.RecordType, err)
 	}
+	return nil
 }
 
 // endpointToRecords converts an endpoint to a slice of records.
@@ -274,12 +492,17 @@ func endpointToRecords(endpoint *endpoint.Endpoint) []sdk.Record {
 	return records
 }
 
+// auditRecord converts a record to the audit format.
+func auditRecord(r sdk.RecordResponse) *ionos.AuditRecord {
+	return &ionos.AuditRecord{Name: r.GetName(), Type: getType(r), Content: r.GetContent(), TTL: r.GetTtl(), Priority: r.GetPrio()}
+}
+
 // recordToEndpoint converts a record to an endpoint.
 func recordToEndpoint(r sdk.RecordResponse) *endpoint.Endpoint {
 	return endpoint.NewEndpointWithTTL(*r.Name, getType(r), endpoint.TTL(*r.Ttl), *r.Content)
 }
 
-// getZones returns a ZoneID -> ZoneName mapping for zones that match domain filter.
+// getZones returns a ZoneID -> ZoneName mapping for zones that match domain filter and zone filter.
 func (p *Provider) getZones(ctx context.Context) (map[string]string, error) {
 	zones, err := p.client.GetZones(ctx)
 	if err != nil {
@@ -289,14 +512,30 @@ func (p *Provider) getZones(ctx context.Context) (map[string]string, error) {
 	result := map[string]string{}
 
 	for _, zone := range zones {
-		if p.BaseProvider.GetDomainFilter().Match(*zone.Name) {
+		if p.domainFilter.Match(*zone.Name) && p.zoneFilter.Match(*zone.Id, *zone.Name) {
 			result[*zone.Id] = *zone.Name
 		}
 	}
+	ionos.SetManagedZones(ionos.BackendCore, p.account, len(result))
 
 	return result, nil
 }
 
+// readZoneNames returns the names of all zones selected by the zone filter.
+func (p *Provider) readZoneNames(ctx context.Context) ([]string, error) {
+	zones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneNames := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		if p.zoneFilter.Match(*zone.Id, *zone.Name) {
+			zoneNames = append(zoneNames, *zone.Name)
+		}
+	}
+	return zoneNames, nil
+}
+
 // getHostZoneID finds the best suitable DNS zone for the hostname.
 func getHostZoneID(hostname string, zones map[string]string) string {
 	longestZoneLength := 0
@@ -326,6 +565,21 @@ func sameEndpoints(a endpoint.Endpoint, b endpoint.Endpoint) bool {
 	return a.DNSName == b.DNSName && a.RecordType == b.RecordType && a.RecordTTL == b.RecordTTL && a.Targets.Same(b.Targets)
 }
 
+// CheckAPI reads the zones to verify, that the API is reachable and accepts the credentials.
+func (p *Provider) CheckAPI(ctx context.Context) error {
+	_, err := p.client.GetZones(ctx)
+	return err
+}
+
+// DeferredDeletions returns the deletions held back for their grace period.
+func (p *Provider) DeferredDeletions() *ionos.DeferredDeletions {
+	return p.deferred
+}
+
+// GetDomainFilter returns the domain filter for external-dns, which is restricted to the discovered zones if enabled.
 func (p *Provider) GetDomainFilter() endpoint.DomainFilterInterface {
+	if p.zoneDomainFilter != nil {
+		return p.zoneDomainFilter
+	}
 	return p.domainFilter
 }
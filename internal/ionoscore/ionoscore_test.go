@@ -2,9 +2,16 @@ package ionoscore
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
 
@@ -14,40 +21,81 @@ import (
 	"sigs.k8s.io/external-dns/plan"
 
 	sdk "github.com/ionos-developer/dns-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
 type mockDnsService struct {
-	testErrorReturned bool
+	testErrorReturned   bool
+	deleteErrorReturned bool
+	createErrorReturned bool
 }
 
 func TestNewProvider(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 
 	domainFilter := endpoint.NewDomainFilter([]string{"a.de."})
-	p := NewProvider(domainFilter, &ionos.Configuration{DryRun: true})
+	p, err := NewProvider(domainFilter, &ionos.Configuration{DryRun: true})
+	require.NoError(t, err)
 	require.Equal(t, true, p.dryRun)
 	require.True(t, p.GetDomainFilter().Match("a.de"))
 	require.False(t, p.GetDomainFilter().Match("ab.de"))
 	require.NotNilf(t, p.client, "client should not be nil")
-	p = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{})
+	p, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{})
+	require.NoError(t, err)
 	require.Equal(t, false, p.dryRun)
 	require.True(t, p.GetDomainFilter().Match("everything"))
 	require.NotNilf(t, p.client, "client should not be nil")
+	p.Close()
+
+	_, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{AuditLog: filepath.Join(t.TempDir(), "missing", "audit.log")})
+	require.ErrorContains(t, err, "failed to create audit log")
+
+	_, err = NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{ProxyURL: "proxy"})
+	require.ErrorContains(t, err, "failed to create HTTP client")
+}
+
+func TestNewProviderRotatesAPIKey(t *testing.T) {
+	apiKeys := make(chan string, 100)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKeys <- r.Header.Get("X-API-Key")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer api.Close()
+	apiKeyFile := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(apiKeyFile, []byte("old.key\n"), 0o600))
+
+	p, err := NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{
+		APIKey:             "old.key",
+		APIKeyFile:         apiKeyFile,
+		APIKeyFileInterval: 10 * time.Millisecond,
+		APIEndpointURL:     api.URL,
+		AuthHeader:         "X-API-Key",
+	})
+	require.NoError(t, err)
+	defer p.Close()
+	require.NoError(t, p.CheckAPI(context.Background()))
+	require.Equal(t, "old.key", <-apiKeys)
+
+	require.NoError(t, os.WriteFile(apiKeyFile, []byte("new.key\n"), 0o600))
+	require.Eventually(t, func() bool {
+		return p.CheckAPI(context.Background()) == nil && <-apiKeys == "new.key"
+	}, time.Second, 20*time.Millisecond)
 }
 
 func TestRecords(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	ctx := context.Background()
 
-	provider := &Provider{client: mockDnsService{testErrorReturned: false}}
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{testErrorReturned: false}}
 	endpoints, err := provider.Records(ctx)
 	if err != nil {
 		t.Errorf("should not fail, %s", err)
 	}
 	require.Equal(t, 5, len(endpoints))
 
-	provider = &Provider{client: mockDnsService{testErrorReturned: true}}
+	provider = &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{testErrorReturned: true}}
 	_, err = provider.Records(ctx)
 
 	if err == nil {
@@ -55,11 +103,205 @@ func TestRecords(t *testing.T) {
 	}
 }
 
+func TestRecordsWithZoneFilter(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, zoneFilter: ionos.NewZoneFilter([]string{"b"}, nil, nil)}
+	endpoints, err := provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	require.Equal(t, "b.de", endpoints[0].DNSName)
+
+	provider = &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, zoneFilter: ionos.NewZoneFilter(nil, []string{"de"}, []string{"b.de"})}
+	endpoints, err = provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 4)
+}
+
+func TestProtectedRecords(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	protection := ionos.NewRecordProtection([]ionos.ProtectionRule{
+		{NamePattern: "aaaa.a.de", RecordType: "AAAA"},
+		{NamePattern: "b.de"},
+	}, true)
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, protection: protection}
+
+	endpoints, err := provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 2)
+	// the protected records are hidden, but counted in the metrics
+	recordsOf := func(zoneName, recordType string) float64 {
+		value, ok := metricValue(t, "ionos_webhook_records", map[string]string{"backend": ionos.BackendCore, "account": "", "zone": zoneName, "type": recordType})
+		require.True(t, ok)
+		return value
+	}
+	require.InDelta(t, 2, recordsOf("a.de", "AAAA"), 0)
+	require.InDelta(t, 1, recordsOf("b.de", "A"), 0)
+
+	deletedBefore := len(deletedRecords["b"])
+	err = provider.ApplyChanges(ctx, &plan.Changes{
+		Delete: []*endpoint.Endpoint{{DNSName: "b.de", RecordType: "A", Targets: endpoint.Targets{"5.5.5.5"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, deletedRecords["b"], deletedBefore)
+}
+
+// metricValue returns the value of the gauge with the given name and labels, if it exists.
+func metricValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return metric.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestApplyChangesFailed(t *testing.T) {
+	ctx := context.Background()
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{createErrorReturned: true}, account: "failing"}
+	lastSuccess := map[string]string{"backend": ionos.BackendCore, "account": "failing", "operation": "apply_changes"}
+
+	err := provider.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("new.a.de", "A", "3.3.3.3"),
+			endpoint.NewEndpoint("new.b.de", "A", "4.4.4.4"),
+		},
+	})
+	require.ErrorContains(t, err, "failed to create records for new.a.de A: CreateRecords failed")
+	require.ErrorContains(t, err, "failed to create records for new.b.de A: CreateRecords failed", "the remaining changes are applied")
+	_, ok := metricValue(t, "ionos_webhook_last_success_timestamp_seconds", lastSuccess)
+	require.False(t, ok, "a failed apply is no success")
+
+	provider.client = mockDnsService{}
+	require.NoError(t, provider.ApplyChanges(ctx, &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.a.de", "A", "3.3.3.3")}}))
+	_, ok = metricValue(t, "ionos_webhook_last_success_timestamp_seconds", lastSuccess)
+	require.True(t, ok)
+}
+
+func TestDeletionGuard(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	guard := ionos.NewDeletionGuard(0, 50, ionos.DeletionGuardModePlan, "")
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, guard: guard}
+
+	deletedBefore := len(deletedRecords["a"])
+	err := provider.ApplyChanges(ctx, &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "a.de", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"}},
+			{DNSName: "cname.a.de", RecordType: "CNAME", Targets: endpoint.Targets{"cname.de"}},
+		},
+	})
+	require.ErrorIs(t, err, ionos.ErrMassDeletion)
+	require.Len(t, deletedRecords["a"], deletedBefore)
+}
+
+func TestDeferredDeletions(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "pending.json")
+	deferred := ionos.NewDeferredDeletions(time.Hour, stateFile, "")
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, deferred: deferred}
+
+	deletedBefore := len(deletedRecords["b"])
+	_, err := provider.Records(ctx)
+	require.NoError(t, err)
+	err = provider.ApplyChanges(ctx, &plan.Changes{
+		Delete: []*endpoint.Endpoint{{DNSName: "b.de", RecordType: "A", Targets: endpoint.Targets{"5.5.5.5"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, deletedRecords["b"], deletedBefore)
+
+	// reading the records without applying a plan, e.g. with the cache of external-dns, keeps the deletion pending
+	for range 2 {
+		_, err = provider.Records(ctx)
+		require.NoError(t, err)
+	}
+	content, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"dnsName": "b.de"`)
+}
+
+func TestDeferredDeletionsRefusedOrFailed(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "pending.json")
+	deferred := ionos.NewDeferredDeletions(time.Nanosecond, stateFile, "")
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}, deferred: deferred}
+	changes := &plan.Changes{
+		Delete: []*endpoint.Endpoint{{DNSName: "a.de", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"}}},
+	}
+	apply := func() error {
+		_, err := provider.Records(ctx)
+		require.NoError(t, err)
+		return provider.ApplyChanges(ctx, changes)
+	}
+	isPending := func() bool {
+		content, err := os.ReadFile(stateFile)
+		require.NoError(t, err)
+		return strings.Contains(string(content), `"dnsName": "a.de"`)
+	}
+	deletedBefore := len(deletedRecords["a"])
+	defer func() { deletedRecords["a"] = deletedRecords["a"][:deletedBefore] }()
+	require.NoError(t, apply())
+	require.True(t, isPending())
+
+	// the grace period is over, but the guard refuses the deletion
+	provider.guard = ionos.NewDeletionGuard(1, 0, ionos.DeletionGuardModePlan, "")
+	require.ErrorIs(t, apply(), ionos.ErrMassDeletion)
+	require.True(t, isPending(), "the refused deletion stays pending")
+
+	// the deletion fails
+	provider.guard = nil
+	provider.client = mockDnsService{deleteErrorReturned: true}
+	require.ErrorContains(t, apply(), "failed to delete record a.de A 1.1.1.1: DeleteRecord failed")
+	require.True(t, isPending(), "the failed deletion stays pending")
+	require.Len(t, deletedRecords["a"], deletedBefore)
+
+	provider.client = mockDnsService{}
+	require.NoError(t, apply())
+	require.False(t, isPending(), "the deletion is done")
+	require.Len(t, deletedRecords["a"], deletedBefore+2)
+}
+
+func TestGetDomainFilterWithZoneDiscovery(t *testing.T) {
+	provider := &Provider{domainFilter: endpoint.NewDomainFilter([]string{"www.a.de", "c.de"}), client: mockDnsService{}}
+	require.Equal(t, provider.domainFilter, provider.GetDomainFilter())
+
+	provider.zoneDomainFilter = ionos.NewZoneDomainFilter(provider.domainFilter, nil)
+	require.NoError(t, provider.zoneDomainFilter.Refresh(context.Background(), provider.readZoneNames))
+	actualJSON, err := json.Marshal(provider.GetDomainFilter())
+	require.NoError(t, err)
+	require.Equal(t, `{"include":["www.a.de"]}`, string(actualJSON))
+}
+
+func TestCheckAPI(t *testing.T) {
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{}}
+	require.NoError(t, provider.CheckAPI(context.Background()))
+
+	provider.client = mockDnsService{testErrorReturned: true}
+	require.Error(t, provider.CheckAPI(context.Background()))
+}
+
 func TestApplyChanges(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	ctx := context.Background()
 
-	provider := &Provider{client: mockDnsService{testErrorReturned: false}}
+	provider := &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{testErrorReturned: false}}
 	err := provider.ApplyChanges(ctx, changes())
 	if err != nil {
 		t.Errorf("should not fail, %s", err)
@@ -80,7 +322,7 @@ func TestApplyChanges(t *testing.T) {
 		t.Errorf("Record new.a.de CNAME a.de not created")
 	}
 
-	provider = &Provider{client: mockDnsService{testErrorReturned: true}}
+	provider = &Provider{domainFilter: &endpoint.DomainFilter{}, client: mockDnsService{testErrorReturned: true}}
 	err = provider.ApplyChanges(ctx, nil)
 
 	if err == nil {
@@ -128,12 +370,18 @@ func (m mockDnsService) GetZone(ctx context.Context, zoneId string) (*sdk.Custom
 	return zone, nil
 }
 
-func (m mockDnsService) CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) error {
+func (m mockDnsService) CreateRecords(ctx context.Context, zoneId string, records []sdk.Record) ([]sdk.RecordResponse, error) {
+	if m.createErrorReturned {
+		return nil, fmt.Errorf("CreateRecords failed")
+	}
 	createdRecords[zoneId] = append(createdRecords[zoneId], records...)
-	return nil
+	return nil, nil
 }
 
 func (m mockDnsService) DeleteRecord(ctx context.Context, zoneId string, recordId string) error {
+	if m.deleteErrorReturned {
+		return fmt.Errorf("DeleteRecord failed")
+	}
 	deletedRecords[zoneId] = append(deletedRecords[zoneId], recordId)
 	return nil
 }
@@ -181,3 +429,37 @@ func isRecordCreated(zoneId string, name string, recordType sdk.RecordTypes, con
 
 	return false
 }
+
+func TestTimeouts(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/zones") {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id":"a","name":"a.de","type":"NATIVE"}]`))
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+	newProvider := func(apiTimeout, syncTimeout time.Duration) *Provider {
+		p, err := NewProvider(&endpoint.DomainFilter{}, &ionos.Configuration{
+			APIKey:         "key",
+			APIEndpointURL: api.URL,
+			AuthHeader:     "X-API-Key",
+			APITimeout:     apiTimeout,
+			SyncTimeout:    syncTimeout,
+		})
+		require.NoError(t, err)
+		t.Cleanup(p.Close)
+		return p
+	}
+
+	_, err := newProvider(50*time.Millisecond, time.Minute).Records(context.Background())
+	var timeoutErr *ionos.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, "GetZone", timeoutErr.Operation, "the call exceeds its timeout")
+
+	_, err = newProvider(time.Minute, 50*time.Millisecond).Records(context.Background())
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, "records", timeoutErr.Operation, "the sync exceeds its timeout")
+	require.Equal(t, 50*time.Millisecond, timeoutErr.Timeout)
+}
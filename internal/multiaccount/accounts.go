@@ -0,0 +1,90 @@
+package multiaccount
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+// Account is an IONOS account of the accounts file. It owns the zones matching its zone patterns and has its own
+// credentials and backend.
+type Account struct {
+	Name         string                  `json:"name"`
+	Provider     ionos.ProviderSelection `json:"provider,omitempty"`
+	Zones        []string                `json:"zones"`
+	APIKey       string                  `json:"apiKey,omitempty"`
+	APIKeyFile   string                  `json:"apiKeyFile,omitempty"`
+	Username     string                  `json:"username,omitempty"`
+	UsernameFile string                  `json:"usernameFile,omitempty"`
+	Password     string                  `json:"password,omitempty"`
+	PasswordFile string                  `json:"passwordFile,omitempty"`
+	APIURL       string                  `json:"apiUrl,omitempty"`
+}
+
+type accountsFile struct {
+	Accounts []Account `json:"accounts"`
+}
+
+// ReadAccountsFile reads and validates the accounts of a YAML or JSON file. Unknown fields are rejected, so that typos
+// do not silently drop credentials.
+func ReadAccountsFile(fileName string) ([]Account, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts file '%s': %w", fileName, err)
+	}
+	var file accountsFile
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts file '%s': %w", fileName, err)
+	}
+	if err := validateAccounts(file.Accounts); err != nil {
+		return nil, fmt.Errorf("invalid accounts file '%s': %w", fileName, err)
+	}
+	return file.Accounts, nil
+}
+
+func validateAccounts(accounts []Account) error {
+	if len(accounts) == 0 {
+		return fmt.Errorf("it contains no accounts")
+	}
+	names := make(map[string]bool, len(accounts))
+	patternOwners := make(map[string]string)
+	for i := range accounts {
+		account := &accounts[i]
+		if account.Name == "" {
+			return fmt.Errorf("account %d has no name", i+1)
+		}
+		if names[account.Name] {
+			return fmt.Errorf("account name '%s' is used more than once", account.Name)
+		}
+		names[account.Name] = true
+		if account.Provider == "" {
+			account.Provider = ionos.ProviderAuto
+		}
+		if len(account.Zones) == 0 {
+			return fmt.Errorf("account '%s' has no zones", account.Name)
+		}
+		for _, pattern := range account.Zones {
+			labels := ionos.SplitLabels(pattern)
+			if len(labels) == 0 || labels[len(labels)-1] == "*" {
+				return fmt.Errorf("zone pattern '%s' of account '%s' must not be empty or end with a wildcard label", pattern, account.Name)
+			}
+			key := strings.Join(labels, ".")
+			if owner, ok := patternOwners[key]; ok {
+				return fmt.Errorf("zone pattern '%s' is assigned to accounts '%s' and '%s'", pattern, owner, account.Name)
+			}
+			patternOwners[key] = account.Name
+		}
+		if err := ionos.ValidateCredentialSettings(
+			ionos.CredentialSetting{Name: "apiKey", FileName: "apiKeyFile", Value: account.APIKey, File: account.APIKeyFile},
+			ionos.CredentialSetting{Name: "username", FileName: "usernameFile", Value: account.Username, File: account.UsernameFile},
+			ionos.CredentialSetting{Name: "password", FileName: "passwordFile", Value: account.Password, File: account.PasswordFile},
+		); err != nil {
+			return fmt.Errorf("account '%s': %w", account.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package multiaccount
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+func writeAccountsFile(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), "accounts.yaml")
+	require.NoError(t, os.WriteFile(fileName, []byte(content), 0o600))
+	return fileName
+}
+
+func TestReadAccountsFile(t *testing.T) {
+	fileName := writeAccountsFile(t, `
+accounts:
+  - name: contract-a
+    provider: cloud
+    zones: [example.com, "*.customers.example.com"]
+    apiKeyFile: /secrets/contract-a
+  - name: hosting
+    zones: [example.org]
+    apiKey: prefix.secret
+    apiUrl: https://hosting.example
+`)
+
+	accounts, err := ReadAccountsFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, []Account{
+		{Name: "contract-a", Provider: ionos.ProviderCloud, Zones: []string{"example.com", "*.customers.example.com"}, APIKeyFile: "/secrets/contract-a"},
+		{Name: "hosting", Provider: ionos.ProviderAuto, Zones: []string{"example.org"}, APIKey: "prefix.secret", APIURL: "https://hosting.example"},
+	}, accounts)
+}
+
+func TestReadAccountsFileErrors(t *testing.T) {
+	cases := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "no accounts",
+			content:       `accounts: []`,
+			expectedError: "invalid accounts file '%s': it contains no accounts",
+		},
+		{
+			name:          "unknown field",
+			content:       `accounts: [{name: a, zones: [a.de], api_key: secret}]`,
+			expectedError: "failed to parse accounts file '%s': error unmarshaling JSON: while decoding JSON: json: unknown field \"api_key\"",
+		},
+		{
+			name:          "invalid provider",
+			content:       `accounts: [{name: a, provider: hosting, zones: [a.de], apiKey: secret}]`,
+			expectedError: "failed to parse accounts file '%s': error unmarshaling JSON: while decoding JSON: invalid provider 'hosting', must be 'core', 'cloud' or 'auto'",
+		},
+		{
+			name:          "missing name",
+			content:       `accounts: [{zones: [a.de], apiKey: secret}]`,
+			expectedError: "invalid accounts file '%s': account 1 has no name",
+		},
+		{
+			name:          "duplicate name",
+			content:       `accounts: [{name: a, zones: [a.de], apiKey: secret}, {name: a, zones: [b.de], apiKey: secret}]`,
+			expectedError: "invalid accounts file '%s': account name 'a' is used more than once",
+		},
+		{
+			name:          "no zones",
+			content:       `accounts: [{name: a, apiKey: secret}]`,
+			expectedError: "invalid accounts file '%s': account 'a' has no zones",
+		},
+		{
+			name:          "zone pattern ending with a wildcard",
+			content:       `accounts: [{name: a, zones: ["example.*"], apiKey: secret}]`,
+			expectedError: "invalid accounts file '%s': zone pattern 'example.*' of account 'a' must not be empty or end with a wildcard label",
+		},
+		{
+			name:          "zone pattern of two accounts",
+			content:       `accounts: [{name: a, zones: [a.de], apiKey: secret}, {name: b, zones: [A.de.], apiKey: secret}]`,
+			expectedError: "invalid accounts file '%s': zone pattern 'A.de.' is assigned to accounts 'a' and 'b'",
+		},
+		{
+			name:          "no credentials",
+			content:       `accounts: [{name: a, zones: [a.de]}]`,
+			expectedError: "invalid accounts file '%s': account 'a': apiKey, apiKeyFile or username and password must be set",
+		},
+		{
+			name:          "username without password",
+			content:       `accounts: [{name: a, zones: [a.de], username: user}]`,
+			expectedError: "invalid accounts file '%s': account 'a': username and password must be set together",
+		},
+		{
+			name:          "api key and username",
+			content:       `accounts: [{name: a, zones: [a.de], apiKey: secret, username: user, passwordFile: /password}]`,
+			expectedError: "invalid accounts file '%s': account 'a': only one of apiKey and username must be set",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fileName := writeAccountsFile(t, tc.content)
+			_, err := ReadAccountsFile(fileName)
+			assert.EqualError(t, err, fmt.Sprintf(tc.expectedError, fileName))
+		})
+	}
+
+	_, err := ReadAccountsFile("/does/not/exist")
+	assert.EqualError(t, err, "failed to read accounts file '/does/not/exist': open /does/not/exist: no such file or directory")
+}
@@ -0,0 +1,210 @@
+package multiaccount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+// ProviderFactory creates the provider of an account, the domain filter is restricted to the zones of the account.
+type ProviderFactory func(account Account, domainFilter endpoint.DomainFilterInterface) (provider.Provider, error)
+
+// closer is implemented by the providers with background work.
+type closer interface {
+	Close()
+}
+
+type account struct {
+	name     string
+	zones    []string
+	provider provider.Provider
+}
+
+var _ provider.Provider = (*Provider)(nil)
+
+// Provider combines the providers of several IONOS accounts. The records of all accounts are merged and every change
+// is routed to the account owning the zone of its endpoint.
+type Provider struct {
+	provider.BaseProvider
+	accounts     []*account
+	domainFilter *ionos.ZoneDomainFilter
+}
+
+// NewProvider creates the providers of the accounts with the factory and returns a provider combining them.
+func NewProvider(domainFilter endpoint.DomainFilterInterface, accounts []Account, createProvider ProviderFactory) (*Provider, error) {
+	p := &Provider{}
+	var allZones []string
+	for _, acc := range accounts {
+		log.Infof("Creating provider of account '%s' for zones %v", acc.Name, acc.Zones)
+		accountProvider, err := createProvider(acc, restrictToZones(domainFilter, acc.Zones))
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("account '%s': %w", acc.Name, err)
+		}
+		p.accounts = append(p.accounts, &account{name: acc.Name, zones: acc.Zones, provider: accountProvider})
+		allZones = append(allZones, acc.Zones...)
+	}
+	p.domainFilter = restrictToZones(domainFilter, allZones)
+	return p, nil
+}
+
+// Close closes the providers of all accounts.
+func (p *Provider) Close() {
+	for _, acc := range p.accounts {
+		if c, ok := acc.provider.(closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// TakeOverDeletions hands the pending deletions of each account of the previous provider over to the account of the
+// same name, e.g. on a reload. Accounts, which were removed, lose their pending deletions.
+func (p *Provider) TakeOverDeletions(previous provider.Provider) {
+	previousAccounts, ok := previous.(*Provider)
+	if !ok {
+		return
+	}
+	for _, acc := range p.accounts {
+		for _, previousAcc := range previousAccounts.accounts {
+			if previousAcc.name == acc.name {
+				ionos.HandOverDeletions(previousAcc.provider, acc.provider)
+			}
+		}
+	}
+}
+
+// restrictToZones returns the domain filter restricted to the domains of the zone patterns.
+func restrictToZones(domainFilter endpoint.DomainFilterInterface, zonePatterns []string) *ionos.ZoneDomainFilter {
+	filter := ionos.NewZoneDomainFilter(domainFilter, ionos.ZonePatternDomains(zonePatterns))
+	filter.SetZones(nil)
+	return filter
+}
+
+// owner returns the account owning the zone of the dns name, nil if there is none. If the zone patterns of several
+// accounts match, the account with the longest zone name wins, and the first account of the file on a tie.
+func (p *Provider) owner(dnsName string) *account {
+	var result *account
+	resultZone := ""
+	for _, acc := range p.accounts {
+		if zoneName := ionos.MatchZonePattern(acc.zones, dnsName); len(zoneName) > len(resultZone) {
+			result, resultZone = acc, zoneName
+		}
+	}
+	return result
+}
+
+// Records returns the records of all accounts. Records of zones owned by another account are dropped, so that every
+// record is managed by exactly one account. It fails if the records of any account cannot be read, because missing
+// records would be recreated by external-dns.
+func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	var result []*endpoint.Endpoint
+	for _, acc := range p.accounts {
+		endpoints, err := acc.provider.Records(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("account '%s': %w", acc.name, err)
+		}
+		for _, ep := range endpoints {
+			if p.owner(ep.DNSName) != acc {
+				log.WithField("account", acc.name).Debugf("ignoring record '%s' of a zone owned by another account", ep.DNSName)
+				continue
+			}
+			result = append(result, ep)
+		}
+	}
+	return result, nil
+}
+
+// ApplyChanges splits the changes by the account owning the zone of each endpoint and applies them per account.
+// A failing account does not stop the other accounts, all errors are returned.
+func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	accountChanges := make(map[*account]*plan.Changes, len(p.accounts))
+	route := func(endpoints []*endpoint.Endpoint, add func(*plan.Changes, *endpoint.Endpoint)) {
+		for _, ep := range endpoints {
+			acc := p.owner(ep.DNSName)
+			if acc == nil {
+				log.Warnf("no account owns the zone of '%s', skipping change of %s record", ep.DNSName, ep.RecordType)
+				continue
+			}
+			if accountChanges[acc] == nil {
+				accountChanges[acc] = &plan.Changes{}
+			}
+			add(accountChanges[acc], ep)
+		}
+	}
+	route(changes.Create, func(c *plan.Changes, ep *endpoint.Endpoint) { c.Create = append(c.Create, ep) })
+	route(changes.UpdateOld, func(c *plan.Changes, ep *endpoint.Endpoint) { c.UpdateOld = append(c.UpdateOld, ep) })
+	route(changes.UpdateNew, func(c *plan.Changes, ep *endpoint.Endpoint) { c.UpdateNew = append(c.UpdateNew, ep) })
+	route(changes.Delete, func(c *plan.Changes, ep *endpoint.Endpoint) { c.Delete = append(c.Delete, ep) })
+	var errs []error
+	for _, acc := range p.accounts {
+		if accountChanges[acc] == nil {
+			continue
+		}
+		if err := acc.provider.ApplyChanges(ctx, accountChanges[acc]); err != nil {
+			errs = append(errs, fmt.Errorf("account '%s': %w", acc.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AdjustEndpoints lets the account owning the zone adjust each endpoint, endpoints without account are kept as they are.
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	accountEndpoints := make(map[*account][]*endpoint.Endpoint, len(p.accounts))
+	var result []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if acc := p.owner(ep.DNSName); acc != nil {
+			accountEndpoints[acc] = append(accountEndpoints[acc], ep)
+		} else {
+			result = append(result, ep)
+		}
+	}
+	for _, acc := range p.accounts {
+		if len(accountEndpoints[acc]) == 0 {
+			continue
+		}
+		adjusted, err := acc.provider.AdjustEndpoints(accountEndpoints[acc])
+		if err != nil {
+			return nil, fmt.Errorf("account '%s': %w", acc.name, err)
+		}
+		result = append(result, adjusted...)
+	}
+	return result, nil
+}
+
+// GetDomainFilter returns the domain filter restricted to the zones of all accounts.
+func (p *Provider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return p.domainFilter
+}
+
+// CheckAPI checks the API of every account, which supports it.
+func (p *Provider) CheckAPI(ctx context.Context) error {
+	var errs []error
+	for _, acc := range p.accounts {
+		if checker, ok := acc.provider.(ionos.APIChecker); ok {
+			if err := checker.CheckAPI(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("account '%s': %w", acc.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckCredentials checks the credentials of every account, which supports it.
+func (p *Provider) CheckCredentials(ctx context.Context) error {
+	var errs []error
+	for _, acc := range p.accounts {
+		if checker, ok := acc.provider.(ionos.CredentialChecker); ok {
+			if err := checker.CheckCredentials(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("account '%s': %w", acc.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,189 @@
+package multiaccount
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/ionos-cloud/external-dns-ionos-webhook/internal/ionos"
+)
+
+type mockProvider struct {
+	provider.BaseProvider
+	domainFilter endpoint.DomainFilterInterface
+	records      []*endpoint.Endpoint
+	recordsErr   error
+	applyErr     error
+	checkErr     error
+	changes      []*plan.Changes
+	deferred     *ionos.DeferredDeletions
+	closed       bool
+}
+
+func (m *mockProvider) Close() {
+	m.closed = true
+}
+
+func (m *mockProvider) Records(context.Context) ([]*endpoint.Endpoint, error) {
+	return m.records, m.recordsErr
+}
+
+func (m *mockProvider) ApplyChanges(_ context.Context, changes *plan.Changes) error {
+	m.changes = append(m.changes, changes)
+	return m.applyErr
+}
+
+func (m *mockProvider) CheckAPI(context.Context) error {
+	return m.checkErr
+}
+
+func (m *mockProvider) DeferredDeletions() *ionos.DeferredDeletions {
+	return m.deferred
+}
+
+func newTestProvider(t *testing.T, domainFilter endpoint.DomainFilterInterface, accounts ...Account) (*Provider, map[string]*mockProvider) {
+	mocks := make(map[string]*mockProvider)
+	p, err := NewProvider(domainFilter, accounts, func(account Account, accountFilter endpoint.DomainFilterInterface) (provider.Provider, error) {
+		mocks[account.Name] = &mockProvider{domainFilter: accountFilter}
+		return mocks[account.Name], nil
+	})
+	require.NoError(t, err)
+	return p, mocks
+}
+
+func TestNewProvider(t *testing.T) {
+	domainFilter, err := ionos.NewDomainFilter([]string{"example.com", "example.org"}, nil, "", "")
+	require.NoError(t, err)
+	p, mocks := newTestProvider(t, domainFilter,
+		Account{Name: "a", Zones: []string{"*.customers.example.com"}},
+		Account{Name: "b", Zones: []string{"example.org", "example.net"}})
+
+	assert.True(t, p.GetDomainFilter().Match("www.acme.customers.example.com"))
+	assert.True(t, p.GetDomainFilter().Match("www.example.org"))
+	assert.False(t, p.GetDomainFilter().Match("www.example.com"), "no account owns the zone")
+	assert.False(t, p.GetDomainFilter().Match("www.example.net"), "excluded by the configured domain filter")
+	assert.True(t, mocks["a"].domainFilter.Match("www.acme.customers.example.com"))
+	assert.False(t, mocks["a"].domainFilter.Match("www.example.org"), "the zone of another account")
+
+	p.Close()
+	assert.True(t, mocks["a"].closed)
+	assert.True(t, mocks["b"].closed)
+
+	created := &mockProvider{}
+	_, err = NewProvider(domainFilter, []Account{{Name: "a"}, {Name: "b"}}, func(account Account, _ endpoint.DomainFilterInterface) (provider.Provider, error) {
+		if account.Name == "b" {
+			return nil, fmt.Errorf("invalid credentials")
+		}
+		return created, nil
+	})
+	assert.EqualError(t, err, "account 'b': invalid credentials")
+	assert.True(t, created.closed, "the providers created before the failure are closed")
+}
+
+func TestRecords(t *testing.T) {
+	p, mocks := newTestProvider(t, nil,
+		Account{Name: "a", Zones: []string{"example.com"}},
+		Account{Name: "b", Zones: []string{"sub.example.com", "example.org"}})
+	mocks["a"].records = []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "1.1.1.1"),
+		endpoint.NewEndpoint("www.sub.example.com", endpoint.RecordTypeA, "1.1.1.2"),
+	}
+	mocks["b"].records = []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.sub.example.com", endpoint.RecordTypeA, "2.2.2.2"),
+		endpoint.NewEndpoint("example.org", endpoint.RecordTypeTXT, "text"),
+	}
+
+	records, err := p.Records(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		mocks["a"].records[0],
+		mocks["b"].records[0],
+		mocks["b"].records[1],
+	}, records, "the record of the zone owned by account b is not taken from account a")
+
+	mocks["b"].recordsErr = fmt.Errorf("unauthorized")
+	_, err = p.Records(context.Background())
+	assert.EqualError(t, err, "account 'b': unauthorized")
+}
+
+func TestApplyChanges(t *testing.T) {
+	p, mocks := newTestProvider(t, nil,
+		Account{Name: "a", Zones: []string{"example.com"}},
+		Account{Name: "b", Zones: []string{"*.customers.example.com"}},
+		Account{Name: "c", Zones: []string{"example.org"}})
+	createA := endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "1.1.1.1")
+	createB := endpoint.NewEndpoint("www.acme.customers.example.com", endpoint.RecordTypeA, "2.2.2.2")
+	oldB := endpoint.NewEndpoint("shop.acme.customers.example.com", endpoint.RecordTypeA, "2.2.2.3")
+	newB := endpoint.NewEndpoint("shop.acme.customers.example.com", endpoint.RecordTypeA, "2.2.2.4")
+	deleteA := endpoint.NewEndpoint("old.example.com", endpoint.RecordTypeCNAME, "www.example.com")
+	unowned := endpoint.NewEndpoint("www.example.net", endpoint.RecordTypeA, "3.3.3.3")
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{createA, createB, unowned},
+		UpdateOld: []*endpoint.Endpoint{oldB},
+		UpdateNew: []*endpoint.Endpoint{newB},
+		Delete:    []*endpoint.Endpoint{deleteA},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*plan.Changes{{Create: []*endpoint.Endpoint{createA}, Delete: []*endpoint.Endpoint{deleteA}}}, mocks["a"].changes)
+	assert.Equal(t, []*plan.Changes{{Create: []*endpoint.Endpoint{createB}, UpdateOld: []*endpoint.Endpoint{oldB}, UpdateNew: []*endpoint.Endpoint{newB}}}, mocks["b"].changes)
+	assert.Empty(t, mocks["c"].changes, "an account without changes is not called")
+
+	mocks["a"].applyErr = fmt.Errorf("failed")
+	err = p.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{createA, createB}})
+	assert.EqualError(t, err, "account 'a': failed")
+	assert.Len(t, mocks["b"].changes, 2, "a failing account does not stop the other accounts")
+}
+
+func TestAdjustEndpoints(t *testing.T) {
+	p, _ := newTestProvider(t, nil,
+		Account{Name: "a", Zones: []string{"example.com"}},
+		Account{Name: "b", Zones: []string{"example.org"}})
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "1.1.1.1"),
+		endpoint.NewEndpoint("www.example.net", endpoint.RecordTypeA, "3.3.3.3"),
+		endpoint.NewEndpoint("www.example.org", endpoint.RecordTypeA, "2.2.2.2"),
+	}
+
+	adjusted, err := p.AdjustEndpoints(endpoints)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, endpoints, adjusted)
+}
+
+func TestCheckAPI(t *testing.T) {
+	p, mocks := newTestProvider(t, nil,
+		Account{Name: "a", Zones: []string{"example.com"}},
+		Account{Name: "b", Zones: []string{"example.org"}})
+	assert.NoError(t, p.CheckAPI(context.Background()))
+	assert.NoError(t, p.CheckCredentials(context.Background()), "the accounts do not check credentials")
+
+	mocks["b"].checkErr = fmt.Errorf("unauthorized")
+	assert.EqualError(t, p.CheckAPI(context.Background()), "account 'b': unauthorized")
+}
+
+func TestTakeOverDeletions(t *testing.T) {
+	previous, previousMocks := newTestProvider(t, nil, Account{Name: "a", Zones: []string{"a.de"}}, Account{Name: "b", Zones: []string{"b.de"}})
+	next, nextMocks := newTestProvider(t, nil, Account{Name: "a", Zones: []string{"a.de"}}, Account{Name: "c", Zones: []string{"b.de"}})
+	for _, mock := range []*mockProvider{previousMocks["a"], previousMocks["b"], nextMocks["a"], nextMocks["c"]} {
+		// a deletion taken over is due, because it has been planned before
+		mock.deferred = ionos.NewDeferredDeletions(time.Nanosecond, "", "")
+	}
+	deleteA := &plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("www.a.de", "A", "1.1.1.1")}}
+	deleteB := &plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("www.b.de", "A", "2.2.2.2")}}
+	previousMocks["a"].deferred.Filter(deleteA, deleteA)
+	previousMocks["b"].deferred.Filter(deleteB, deleteB)
+
+	ionos.HandOverDeletions(previous, next)
+	assert.Len(t, nextMocks["a"].deferred.Filter(deleteA, deleteA).Delete, 1, "the account of the same name takes over")
+	assert.Empty(t, nextMocks["c"].deferred.Filter(deleteB, deleteB).Delete, "the deletions of a removed account are dropped")
+
+	// a single provider does not hand over to the accounts
+	next.TakeOverDeletions(previousMocks["a"])
+}